@@ -3,16 +3,27 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/client"
 	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/creative"
 	"github.com/fast-ads-backend/golang-ssai/internal/handler"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/internal/ratelimit"
+	"github.com/fast-ads-backend/golang-ssai/internal/service"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -24,7 +35,16 @@ func main() {
 
 	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		slog.Error("Failed to load config", "path", configPath, "error", err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logging.New(cfg.Logging, os.Stdout))
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
 	}
 
 	// Set Gin mode
@@ -34,28 +54,132 @@ func main() {
 
 	// Initialize router
 	router := gin.New()
-	router.Use(gin.Logger())
+	// Forwarded client IPs are only taken from configured proxies (gin trusts all by default)
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted_proxies", "error", err)
+		os.Exit(1)
+	}
+	router.Use(handler.RequestLogger(cfg))
+	router.Use(handler.Tracing(cfg))
 	router.Use(gin.Recovery())
 
+	// Initialize shared dependencies
+	sharedCache, err := cache.New(cfg)
+	if err != nil {
+		slog.Error("Failed to create cache", "error", err)
+		os.Exit(1)
+	}
+	defer sharedCache.Close()
+
+	if pinger, ok := sharedCache.(cache.Pinger); ok {
+		pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := pinger.Ping(pingCtx); err != nil {
+			slog.Warn("Redis is unreachable at startup", "error", err)
+		} else {
+			slog.Info("Connected to Redis", "mode", redisMode(cfg))
+		}
+		cancel()
+	}
+
+	creativeRegistry := creative.NewRegistry(sharedCache, cfg.Creatives.RegistryTTL)
+	var conditioner *creative.Conditioner
+	if cfg.Creatives.Enabled {
+		conditioner = creative.NewConditioner(cfg.Creatives, creativeRegistry)
+	}
+
+	// One Laravel client, so retries and circuit breakers see all traffic
+	laravelClient := client.NewLaravelClient(cfg, sharedCache)
+
+	availRecorder := service.NewAvailRecorder(sharedCache, laravelClient, cfg.Avails)
+	var manifestAvails *service.AvailRecorder
+	if cfg.Avails.Enabled {
+		manifestAvails = availRecorder
+	}
+
+	playlistMonitor := service.NewPlaylistMonitor(cfg, sharedCache)
+	var manifestMonitor *service.PlaylistMonitor
+	if cfg.PlaylistHealth.Enabled {
+		manifestMonitor = playlistMonitor
+	}
+
+	if cfg.Laravel.APIKey == "" {
+		slog.Warn("laravel.api_key is empty, channel lookups are unauthenticated")
+	}
+	if cfg.Tracking.TokenSecret == "" && len(cfg.Tracking.APIKeys) == 0 {
+		slog.Warn("No tracking token secret or tenant API keys configured, tracking requests will be rejected")
+	}
+	for _, tenant := range proxyTenantsWithoutSecret(cfg) {
+		slog.Warn("Segment proxy has no proxy_secret, segments are passed through", "tenant", tenant)
+	}
+
 	// Initialize handlers
-	manifestHandler := handler.NewManifestHandler(cfg)
-	trackingHandler := handler.NewTrackingHandler(cfg)
-	healthHandler := handler.NewHealthHandler()
+	manifestHandler := handler.NewManifestHandler(cfg, sharedCache, laravelClient, conditioner, manifestAvails, manifestMonitor)
+	trackingHandler := handler.NewTrackingHandler(cfg, laravelClient)
+	healthHandler := handler.NewHealthHandler(cfg, sharedCache, laravelClient)
+	creativeHandler := handler.NewCreativeHandler(creativeRegistry, conditioner)
+	availHandler := handler.NewAvailHandler(availRecorder)
+	playlistHealthHandler := handler.NewPlaylistHealthHandler(playlistMonitor)
+	segmentProxy := handler.NewSegmentProxyHandler(cfg)
+
+	// Rate limiting (manifest and tracking endpoints have separate buckets)
+	manifestLimit, trackingIPLimit, trackingLimit := noopMiddleware, noopMiddleware, noopMiddleware
+	if cfg.RateLimiting.Enabled {
+		limiter := ratelimit.New(cfg.RateLimiting, sharedCache)
+		manifestLimit = handler.ManifestRateLimit(cfg, limiter)
+		manifestHandler.LimitTenants(handler.ManifestTenantRateLimit(cfg, limiter))
+		trackingIPLimit = handler.TrackingIPRateLimit(cfg, limiter)
+		trackingLimit = handler.TrackingRateLimit(cfg, limiter)
+	}
 
 	// Routes
 	api := router.Group("/")
 	{
 		// Manifest endpoint - handle both with and without .m3u8 extension in handler
-		api.GET("/fast/:tenant/:channel", manifestHandler.GetManifest)
+		api.GET("/fast/:tenant/:channel", manifestLimit, manifestHandler.GetManifest)
+		
+		// Tracking endpoints: limited per IP before authentication (so API keys can't be
+		// guessed unlimited), and per tenant and session after it (so buckets use the real tenant)
+		trackingAuth := handler.TrackingAuth(cfg)
+		api.POST("/tracking/impression", trackingIPLimit, trackingAuth, trackingLimit, trackingHandler.TrackImpression)
+		api.POST("/tracking/quartile", trackingIPLimit, trackingAuth, trackingLimit, trackingHandler.TrackQuartile)
+		api.POST("/tracking/complete", trackingIPLimit, trackingAuth, trackingLimit, trackingHandler.TrackComplete)
 		
-		// Tracking endpoints
-		api.POST("/tracking/impression", trackingHandler.TrackImpression)
-		api.POST("/tracking/quartile", trackingHandler.TrackQuartile)
-		api.POST("/tracking/complete", trackingHandler.TrackComplete)
+		// Proxied segments (segment_urls.strategy: proxy)
+		api.GET("/segments/:tenant/:bind/:expires/:signature/:target/:name", segmentProxy.Serve)
+		api.HEAD("/segments/:tenant/:bind/:expires/:signature/:target/:name", segmentProxy.Serve)
 		
 		// Health check (must be before /fast/ to avoid route conflict)
 		api.GET("/health", healthHandler.Health)
-		api.GET("/metrics", healthHandler.Metrics)
+		api.GET("/health/live", healthHandler.Live)
+		api.GET("/health/ready", healthHandler.Ready)
+	}
+
+	// Prometheus metrics
+	if cfg.Metrics.Enabled {
+		if pool, ok := sharedCache.(interface{ PoolStats() *redis.PoolStats }); ok {
+			prometheus.MustRegister(metrics.NewRedisPoolCollector(pool.PoolStats))
+		}
+
+		metricsPath := cfg.Metrics.Path
+		if metricsPath == "" {
+			metricsPath = "/metrics"
+		}
+		router.GET(metricsPath, gin.WrapH(promhttp.Handler()))
+	}
+
+	// Admin endpoints
+	admin := router.Group("/admin", handler.AdminAuth(cfg))
+	{
+		admin.GET("/creatives", creativeHandler.List)
+		admin.DELETE("/creatives/:key", creativeHandler.Purge)
+		admin.POST("/creatives/:key/requeue", creativeHandler.Requeue)
+		admin.GET("/avails", availHandler.Stats)
+		admin.GET("/playlist-health", playlistHealthHandler.Status)
+	}
+
+	// Conditioned creatives (MP4 ads transcoded to HLS)
+	if cfg.Creatives.Enabled && cfg.Creatives.OutputDir != "" {
+		router.Static("/creatives", cfg.Creatives.OutputDir)
 	}
 
 	// Create HTTP server
@@ -68,9 +192,10 @@ func main() {
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Starting SSAI service on %s:%d", cfg.Server.Host, cfg.Server.Port)
+		slog.Info("Starting SSAI service", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			slog.Error("Failed to start server", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -79,16 +204,47 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
+		os.Exit(1)
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
 	}
 
-	log.Println("Server exited")
+	slog.Info("Server exited")
+}
+
+
+func noopMiddleware(c *gin.Context) {
+	c.Next()
 }
 
+func redisMode(cfg *config.Config) string {
+	if cfg.Redis.Mode == "" {
+		return config.RedisModeSingle
+	}
+	return cfg.Redis.Mode
+}
+
+// proxyTenantsWithoutSecret lists the tenants ("*" for the default) that use the segment
+// proxy without a proxy_secret
+func proxyTenantsWithoutSecret(cfg *config.Config) []string {
+	var tenants []string
+	if s := cfg.SegmentURLsFor(""); s.Strategy == config.SegmentURLProxy && s.ProxySecret == "" {
+		tenants = append(tenants, "*")
+	}
+	for tenant := range cfg.SegmentURLs.Tenants {
+		if s := cfg.SegmentURLsFor(tenant); s.Strategy == config.SegmentURLProxy && s.ProxySecret == "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+)
+
+// Cache backends
+const (
+	BackendRedis  = "redis"
+	BackendMemory = "memory"
+	BackendTiered = "tiered"
+)
+
+// ErrMiss is returned by Get when a key isn't cached (or has expired)
+var ErrMiss = errors.New("cache: miss")
+
+// Cache is a string key/value store with per-key TTL (0 means no expiry)
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// IncrBy atomically adds delta to an integer counter (created at 0) and returns the new
+	// value; ttl (if > 0) is reset on every increment
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Keys returns all keys starting with prefix
+	Keys(ctx context.Context, prefix string) ([]string, error)
+	Close() error
+}
+
+// Pinger is implemented by caches backed by a remote store (Redis)
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Swapper is implemented by caches that can update a key atomically
+type Swapper interface {
+	// CompareAndSwap sets key to value if it holds old ("" for a missing key) and
+	// reports whether it did
+	CompareAndSwap(ctx context.Context, key, old, value string, ttl time.Duration) (bool, error)
+}
+
+// Shared returns the tier of c every instance reads and writes (the far tier of a
+// tiered cache), for state that must never be served from a stale near copy
+func Shared(c Cache) Cache {
+	if tiered, ok := c.(*TieredCache); ok {
+		return tiered.far
+	}
+	return c
+}
+
+// New creates the cache backend selected by cache.backend (redis by default)
+func New(cfg *config.Config) (Cache, error) {
+	switch cfg.Cache.Backend {
+	case "", BackendRedis:
+		return NewRedisCache(cfg)
+	case BackendMemory:
+		return NewMemoryCache(cfg.Cache.MemoryMaxEntries), nil
+	case BackendTiered:
+		redisCache, err := NewRedisCache(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewTieredCache(NewMemoryCache(cfg.Cache.MemoryMaxEntries), redisCache, cfg.Cache.NearTTL), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Cache.Backend)
+	}
+}
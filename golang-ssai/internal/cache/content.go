@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/pkg/cachebust"
+	"golang.org/x/sync/singleflight"
+)
+
+// fetchTimeout bounds a shared fetch once it's detached from the requests waiting on it
+const fetchTimeout = 10 * time.Second
+
+// FetchFunc fetches a document from the network.
+// It returns the TTL to cache the document for; ttl <= 0 means don't cache it.
+type FetchFunc func(ctx context.Context) (body string, ttl time.Duration, err error)
+
+// ContentCache caches fetched documents (VAST XML, ad playlists) keyed by URL with
+// cache busters stripped, and coalesces concurrent fetches of the same document
+type ContentCache struct {
+	cache  Cache
+	prefix string
+	group  singleflight.Group
+}
+
+func NewContentCache(c Cache, prefix string) *ContentCache {
+	return &ContentCache{cache: c, prefix: prefix}
+}
+
+// Key returns the cache key of a document URL
+func (cc *ContentCache) Key(rawURL string) string {
+	sum := sha256.Sum256([]byte(cachebust.Strip(rawURL)))
+	return cc.prefix + ":" + hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached document for rawURL, calling fetch on a miss.
+// Concurrent misses for the same document share one fetch.
+func (cc *ContentCache) Get(ctx context.Context, rawURL string, fetch FetchFunc) (string, error) {
+	key := cc.Key(rawURL)
+
+	if body, err := cc.cache.Get(ctx, key); err == nil && body != "" {
+		logging.FromContext(ctx).Debug("Content cache hit", "cache", cc.prefix, "url", rawURL)
+		return body, nil
+	}
+
+	// Detach the fetch from the caller's cancellation: other requests may be waiting on it
+	ch := cc.group.DoChan(key, func() (interface{}, error) {
+		flightCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+
+		body, ttl, err := fetch(flightCtx)
+		if err != nil {
+			return "", err
+		}
+		if ttl > 0 && body != "" {
+			if err := cc.cache.Set(flightCtx, key, body, ttl); err != nil {
+				logging.FromContext(flightCtx).Warn("Failed to cache content", "cache", cc.prefix, "url", rawURL, "error", err)
+			}
+		}
+		return body, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// CacheControlTTL returns how long a response may be cached according to its
+// Cache-Control header, capped at maxTTL. Responses without max-age use maxTTL.
+func CacheControlTTL(header string, maxTTL time.Duration) time.Duration {
+	ttl := maxTTL
+	for _, directive := range strings.Split(header, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store" || directive == "no-cache" || directive == "private":
+			return 0
+		case strings.HasPrefix(directive, "s-maxage=") || strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(directive[strings.Index(directive, "=")+1:])
+			if err != nil {
+				continue
+			}
+			if maxAge := time.Duration(seconds) * time.Second; maxAge < ttl {
+				ttl = maxAge
+			}
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	memoryShards            = 32
+	defaultMemoryMaxEntries = 100000
+)
+
+// MemoryCache is an in-process LRU cache with per-key TTL, sharded to keep lock
+// contention low. Each shard holds at most maxEntries/shards keys.
+type MemoryCache struct {
+	shards []*memoryShard
+}
+
+type memoryShard struct {
+	mu         sync.Mutex
+	maxEntries int
+	items      map[string]*list.Element
+	lru        *list.List // front is most recently used
+}
+
+type memoryEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time // zero means no expiry
+}
+
+// NewMemoryCache creates an in-memory cache holding about maxEntries keys
+// (a default size is used if maxEntries <= 0)
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultMemoryMaxEntries
+	}
+
+	perShard := maxEntries / memoryShards
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	c := &MemoryCache{shards: make([]*memoryShard, memoryShards)}
+	for i := range c.shards {
+		c.shards[i] = &memoryShard{
+			maxEntries: perShard,
+			items:      make(map[string]*list.Element),
+			lru:        list.New(),
+		}
+	}
+	return c
+}
+
+func (c *MemoryCache) shard(key string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	value, _, err := c.GetWithTTL(ctx, key)
+	return value, err
+}
+
+// GetWithTTL returns a value and its remaining TTL (0 if it never expires)
+func (c *MemoryCache) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return "", 0, ErrMiss
+	}
+
+	entry := el.Value.(*memoryEntry)
+	var ttl time.Duration
+	if !entry.expiresAt.IsZero() {
+		ttl = time.Until(entry.expiresAt)
+		if ttl <= 0 {
+			s.remove(el)
+			return "", 0, ErrMiss
+		}
+	}
+
+	s.lru.MoveToFront(el)
+	return entry.value, ttl, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set(key, value, expiresAt)
+	return nil
+}
+
+// set stores a value; the caller holds s.mu
+func (s *memoryShard) set(key, value string, expiresAt time.Time) {
+	if el, ok := s.items[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		s.lru.MoveToFront(el)
+		return
+	}
+
+	s.items[key] = s.lru.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+// CompareAndSwap sets key to value if it holds old ("" for a missing key)
+func (c *MemoryCache) CompareAndSwap(ctx context.Context, key, old, value string, ttl time.Duration) (bool, error) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := ""
+	if el, ok := s.items[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		if entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt) {
+			current = entry.value
+		}
+	}
+	if current != old {
+		return false, nil
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	s.set(key, value, expiresAt)
+	return true, nil
+}
+
+func (c *MemoryCache) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	el, ok := s.items[key]
+	if ok && el.Value.(*memoryEntry).expired(time.Now()) {
+		s.remove(el)
+		ok = false
+	}
+	if !ok {
+		s.items[key] = s.lru.PushFront(&memoryEntry{key: key, value: strconv.FormatInt(delta, 10), expiresAt: expiresAt})
+		for s.lru.Len() > s.maxEntries {
+			s.remove(s.lru.Back())
+		}
+		return delta, nil
+	}
+
+	entry := el.Value.(*memoryEntry)
+	value, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of %s is not an integer", key)
+	}
+	value += delta
+	entry.value = strconv.FormatInt(value, 10)
+	if ttl > 0 {
+		entry.expiresAt = expiresAt
+	}
+	s.lru.MoveToFront(el)
+	return value, nil
+}
+
+// Keys returns all unexpired keys starting with prefix
+func (c *MemoryCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	now := time.Now()
+	var keys []string
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for key, el := range s.items {
+			entry := el.Value.(*memoryEntry)
+			if strings.HasPrefix(key, prefix) && (entry.expiresAt.IsZero() || now.Before(entry.expiresAt)) {
+				keys = append(keys, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return keys, nil
+}
+
+func (c *MemoryCache) Close() error {
+	return nil
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// remove drops an element; the shard lock must be held
+func (s *memoryShard) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.items, el.Value.(*memoryEntry).key)
+}
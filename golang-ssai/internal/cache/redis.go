@@ -2,6 +2,12 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fast-ads-backend/golang-ssai/internal/config"
@@ -9,36 +15,226 @@ import (
 )
 
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
-func NewRedisCache(cfg *config.Config) *RedisCache {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:         cfg.Redis.Host,
-		Password:     cfg.Redis.Password,
-		DB:           cfg.Redis.DB,
-		PoolSize:     cfg.Redis.PoolSize,
-		MinIdleConns: cfg.Redis.MinIdleConns,
-	})
+// NewRedisCache connects to a single Redis node, a Sentinel-managed master or a
+// Redis Cluster depending on redis.mode
+func NewRedisCache(cfg *config.Config) (*RedisCache, error) {
+	tlsConfig, err := redisTLSConfig(cfg.Redis.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	var rdb redis.UniversalClient
+	switch cfg.Redis.Mode {
+	case "", config.RedisModeSingle:
+		rdb = redis.NewClient(&redis.Options{
+			Addr:         cfg.Redis.Host,
+			Password:     cfg.Redis.Password,
+			DB:           cfg.Redis.DB,
+			PoolSize:     cfg.Redis.PoolSize,
+			MinIdleConns: cfg.Redis.MinIdleConns,
+			TLSConfig:    tlsConfig,
+		})
+	case config.RedisModeSentinel:
+		if cfg.Redis.MasterName == "" || len(cfg.Redis.Addrs) == 0 {
+			return nil, fmt.Errorf("redis sentinel mode requires master_name and addrs")
+		}
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.Redis.MasterName,
+			SentinelAddrs:    cfg.Redis.Addrs,
+			SentinelPassword: cfg.Redis.SentinelPassword,
+			Password:         cfg.Redis.Password,
+			DB:               cfg.Redis.DB,
+			PoolSize:         cfg.Redis.PoolSize,
+			MinIdleConns:     cfg.Redis.MinIdleConns,
+			TLSConfig:        tlsConfig,
+		})
+	case config.RedisModeCluster:
+		if len(cfg.Redis.Addrs) == 0 {
+			return nil, fmt.Errorf("redis cluster mode requires addrs")
+		}
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Redis.Addrs,
+			Password:     cfg.Redis.Password,
+			PoolSize:     cfg.Redis.PoolSize,
+			MinIdleConns: cfg.Redis.MinIdleConns,
+			TLSConfig:    tlsConfig,
+		})
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Redis.Mode)
+	}
 
 	return &RedisCache{
 		client: rdb,
+	}, nil
+}
+
+func redisTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
 	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Ping checks that Redis is reachable
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
 }
 
 func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
-	return c.client.Get(ctx, key).Result()
+	value, err := c.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrMiss
+	}
+	return value, err
+}
+
+// GetWithTTL returns a value and its remaining TTL (0 if it never expires)
+func (c *RedisCache) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	pipe := c.client.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", 0, err
+	}
+
+	value, err := get.Result()
+	if err == redis.Nil {
+		return "", 0, ErrMiss
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl := pttl.Val()
+	if ttl < 0 {
+		ttl = 0 // no expiry
+	}
+	return value, ttl, nil
 }
 
 func (c *RedisCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
 	return c.client.Set(ctx, key, value, ttl).Err()
 }
 
+// compareAndSwapScript sets KEYS[1] to ARGV[2] (with a TTL of ARGV[3] ms, none if 0)
+// if it holds ARGV[1] ("" for a missing key)
+var compareAndSwapScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if (current or "") ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// CompareAndSwap sets key to value if it holds old ("" for a missing key)
+func (c *RedisCache) CompareAndSwap(ctx context.Context, key, old, value string, ttl time.Duration) (bool, error) {
+	swapped, err := compareAndSwapScript.Run(ctx, c.client, []string{key}, old, value, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return swapped == 1, nil
+}
+
 func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
 
+func (c *RedisCache) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	pipe := c.client.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, delta)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// Keys returns all keys starting with prefix (uses SCAN, safe on large keyspaces).
+// In cluster mode every master is scanned.
+func (c *RedisCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	cluster, ok := c.client.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(ctx, c.client, prefix)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanKeys(ctx, node, prefix)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
+func scanKeys(ctx context.Context, client redis.Cmdable, prefix string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, escapeGlob(prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// escapeGlob escapes the glob characters of a SCAN MATCH pattern, so prefixes match
+// literally (as in the other backends)
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// PoolStats returns the connection pool stats of the Redis client
+func (c *RedisCache) PoolStats() *redis.PoolStats {
+	return c.client.PoolStats()
+}
+
+// Client returns the underlying Redis client, for features that need more than the
+// Cache interface (e.g. scripts)
+func (c *RedisCache) Client() redis.UniversalClient {
+	return c.client
+}
+
 func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
-
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultNearTTL = 5 * time.Second
+
+// ttlGetter is implemented by caches that can report a key's remaining TTL
+type ttlGetter interface {
+	GetWithTTL(ctx context.Context, key string) (string, time.Duration, error)
+}
+
+// TieredCache is a two-tier near cache: reads are served from an in-process cache
+// when possible and fall back to the shared one (usually Redis). Near copies live at
+// most nearTTL, which bounds how stale an instance can be after another one writes.
+type TieredCache struct {
+	near    *MemoryCache
+	far     Cache
+	nearTTL time.Duration
+}
+
+// NewTieredCache combines near and far; a default near TTL is used if nearTTL <= 0
+func NewTieredCache(near *MemoryCache, far Cache, nearTTL time.Duration) *TieredCache {
+	if nearTTL <= 0 {
+		nearTTL = defaultNearTTL
+	}
+	return &TieredCache{near: near, far: far, nearTTL: nearTTL}
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string) (string, error) {
+	if value, err := c.near.Get(ctx, key); err == nil {
+		return value, nil
+	}
+
+	// Never keep a near copy longer than the far one lives
+	var value string
+	var ttl time.Duration
+	var err error
+	if far, ok := c.far.(ttlGetter); ok {
+		value, ttl, err = far.GetWithTTL(ctx, key)
+	} else {
+		value, err = c.far.Get(ctx, key)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.near.Set(ctx, key, value, c.nearTTLFor(ttl))
+	return value, nil
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.near.Set(ctx, key, value, c.nearTTLFor(ttl))
+	return c.far.Set(ctx, key, value, ttl)
+}
+
+// Delete removes the key from both tiers (other instances' near copies expire on their own)
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	c.near.Delete(ctx, key)
+	return c.far.Delete(ctx, key)
+}
+
+// IncrBy increments the shared counter; counters are never served from the near tier
+func (c *TieredCache) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	c.near.Delete(ctx, key)
+	return c.far.IncrBy(ctx, key, delta, ttl)
+}
+
+// CompareAndSwap swaps key in the far cache; near copies are never compared
+func (c *TieredCache) CompareAndSwap(ctx context.Context, key, old, value string, ttl time.Duration) (bool, error) {
+	c.near.Delete(ctx, key)
+	swapper, ok := c.far.(Swapper)
+	if !ok {
+		return false, fmt.Errorf("cache: far tier can't compare and swap")
+	}
+	return swapper.CompareAndSwap(ctx, key, old, value, ttl)
+}
+
+// Keys lists keys from the shared tier, which holds every key
+func (c *TieredCache) Keys(ctx context.Context, prefix string) ([]string, error) {
+	return c.far.Keys(ctx, prefix)
+}
+
+// Ping checks the shared tier
+func (c *TieredCache) Ping(ctx context.Context) error {
+	if pinger, ok := c.far.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// PoolStats returns the connection pool stats of the shared tier, if it is Redis
+func (c *TieredCache) PoolStats() *redis.PoolStats {
+	if far, ok := c.far.(*RedisCache); ok {
+		return far.PoolStats()
+	}
+	return &redis.PoolStats{}
+}
+
+// Client returns the Redis client of the far cache, or nil if it isn't Redis
+func (c *TieredCache) Client() redis.UniversalClient {
+	if far, ok := c.far.(*RedisCache); ok {
+		return far.Client()
+	}
+	return nil
+}
+
+func (c *TieredCache) Close() error {
+	c.near.Close()
+	return c.far.Close()
+}
+
+func (c *TieredCache) nearTTLFor(ttl time.Duration) time.Duration {
+	if ttl > 0 && ttl < c.nearTTL {
+		return ttl
+	}
+	return c.nearTTL
+}
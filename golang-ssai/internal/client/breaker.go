@@ -0,0 +1,101 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+)
+
+// Circuit breaker states (also the value of the laravel_circuit_state gauge)
+const (
+	circuitClosed   = 0
+	circuitHalfOpen = 1
+	circuitOpen     = 2
+)
+
+// circuitBreaker stops calls to a failing Laravel endpoint. It opens after threshold
+// consecutive failures; after cooldown a single probe is let through (half-open) and
+// its outcome closes or re-opens the breaker.
+type circuitBreaker struct {
+	endpoint  string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(endpoint string, threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	metrics.LaravelCircuitState.WithLabelValues(endpoint).Set(circuitClosed)
+	return &circuitBreaker{endpoint: endpoint, threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may go through
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(circuitHalfOpen)
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record reports the outcome of a call let through by allow
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.setState(circuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
+
+// release ends a call let through by allow without an outcome (the caller gave up),
+// letting the next call probe if the breaker is half-open
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// setState changes the state; the lock must be held
+func (b *circuitBreaker) setState(state int) {
+	if b.state != state {
+		b.state = state
+		metrics.LaravelCircuitState.WithLabelValues(b.endpoint).Set(float64(state))
+	}
+}
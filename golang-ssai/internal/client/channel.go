@@ -3,15 +3,54 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
 	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // GetChannelBySlug gets channel information by tenant slug and channel slug
 func (c *LaravelClient) GetChannelBySlug(ctx context.Context, tenantSlug, channelSlug string) (*models.ChannelInfo, error) {
+	ctx, span := tracing.Start(ctx, "laravel.GetChannelBySlug",
+		attribute.String("tenant", tenantSlug), attribute.String("channel", channelSlug))
+	key := fmt.Sprintf("laravel:channel:%s:%s", tenantSlug, channelSlug)
+	v, err := c.cachedLookup(ctx, endpointChannel, key,
+		func(data []byte) (interface{}, error) {
+			var info models.ChannelInfo
+			if err := json.Unmarshal(data, &info); err != nil {
+				return nil, err
+			}
+			// Cached copies have no signing secret: one cached by another instance (or
+			// before a restart) is only usable once this instance has fetched the secret
+			if info.RequireSignedURLs {
+				secret, ok := c.signingSecret(key)
+				if !ok {
+					return nil, errNoSigningSecret
+				}
+				info.URLSigningSecret = secret
+			}
+			return &info, nil
+		},
+		func(ctx context.Context) (interface{}, error) {
+			info, err := c.getChannelBySlug(ctx, tenantSlug, channelSlug)
+			if err == nil {
+				c.setSigningSecret(key, info.URLSigningSecret)
+			}
+			return info, err
+		})
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return v.(*models.ChannelInfo), nil
+}
+
+func (c *LaravelClient) getChannelBySlug(ctx context.Context, tenantSlug, channelSlug string) (*models.ChannelInfo, error) {
 	// Call Laravel API to get channel info
 	url := fmt.Sprintf("%s/api/v1/channels/%s/%s", c.baseURL, tenantSlug, channelSlug)
 
@@ -22,7 +61,7 @@ func (c *LaravelClient) GetChannelBySlug(ctx context.Context, tenantSlug, channe
 
 	httpReq.Header.Set("X-API-Key", c.apiKey)
 
-	resp, err := c.client.Do(httpReq)
+	resp, err := c.do(httpReq, endpointChannel)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -34,8 +73,11 @@ func (c *LaravelClient) GetChannelBySlug(ctx context.Context, tenantSlug, channe
 	}
 
 	var response struct {
-		Success bool              `json:"success"`
-		Data     models.ChannelInfo `json:"data"`
+		Success bool `json:"success"`
+		Data    struct {
+			models.ChannelInfo
+			URLSigningSecret string `json:"url_signing_secret"` // ChannelInfo doesn't serialize it
+		} `json:"data"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
@@ -46,6 +88,31 @@ func (c *LaravelClient) GetChannelBySlug(ctx context.Context, tenantSlug, channe
 		return nil, fmt.Errorf("API returned success=false")
 	}
 
-	return &response.Data, nil
+	info := response.Data.ChannelInfo
+	info.URLSigningSecret = response.Data.URLSigningSecret
+	if c.insecureTLS && info.URLSigningSecret != "" {
+		// Secrets aren't trusted to a connection whose certificate isn't verified
+		logging.FromContext(ctx).Warn("Ignoring URL signing secret received with TLS verification disabled",
+			logging.KeyTenant, tenantSlug, logging.KeyChannel, channelSlug)
+		info.URLSigningSecret = ""
+	}
+
+	return &info, nil
+}
+
+// errNoSigningSecret rejects a cached channel whose signing secret this instance doesn't hold
+var errNoSigningSecret = errors.New("signing secret not held in memory")
+
+func (c *LaravelClient) signingSecret(key string) (string, bool) {
+	c.secretsMu.Lock()
+	defer c.secretsMu.Unlock()
+	secret, ok := c.secrets[key]
+	return secret, ok
+}
+
+func (c *LaravelClient) setSigningSecret(key, secret string) {
+	c.secretsMu.Lock()
+	defer c.secretsMu.Unlock()
+	c.secrets[key] = secret
 }
 
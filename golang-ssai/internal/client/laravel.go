@@ -8,25 +8,44 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
 	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
 	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
 )
 
 type LaravelClient struct {
-	baseURL string
-	timeout time.Duration
-	client  *http.Client
-	apiKey  string
-}
+	baseURL       string
+	timeout       time.Duration
+	client        *http.Client
+	apiKey        string
+	tenantAPIKeys map[int]string
+	insecureTLS   bool // certificates aren't verified, so no secrets are accepted
 
-func NewLaravelClient(cfg *config.Config) *LaravelClient {
-	apiKey := "test_api_key_123" // Default, should come from config or tenant lookup
-	if cfg.Laravel.APIKey != "" {
-		apiKey = cfg.Laravel.APIKey
-	}
+	retryAttempts int
+	retryDelay    time.Duration
+	breakers      map[string]*circuitBreaker
+
+	// Channel metadata cache; nil disables it
+	cache       cache.Cache
+	metadataTTL time.Duration // served without asking Laravel
+	staleTTL    time.Duration // then served only while Laravel is unavailable
+	group       singleflight.Group
+
+	// URL signing secrets by channel cache key, kept out of the shared cache
+	secretsMu sync.Mutex
+	secrets   map[string]string
+}
 
+// NewLaravelClient creates the Laravel API client. Channel info and config are cached
+// in c (which may be nil) so manifests keep playing through Laravel outages.
+func NewLaravelClient(cfg *config.Config, c cache.Cache) *LaravelClient {
 	baseURL := cfg.Laravel.BaseURL
 	// Ensure base URL doesn't have trailing slash
 	if len(baseURL) > 0 && baseURL[len(baseURL)-1] == '/' {
@@ -36,23 +55,65 @@ func NewLaravelClient(cfg *config.Config) *LaravelClient {
 	// Create HTTP client with custom transport for SSL verification
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true, // Skip SSL verification for now (use proper certs in production)
+			InsecureSkipVerify: cfg.Laravel.InsecureSkipVerify, // development only
 		},
 	}
 
+	retryAttempts := cfg.Laravel.RetryAttempts
+	if retryAttempts <= 0 {
+		retryAttempts = 1
+	}
+	retryDelay := cfg.Laravel.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = 100 * time.Millisecond
+	}
+
+	breakers := make(map[string]*circuitBreaker)
+	for _, endpoint := range []string{endpointChannel, endpointChannelConfig, endpointAdDecision, endpointTracking, endpointAvails} {
+		breakers[endpoint] = newCircuitBreaker(endpoint, cfg.Laravel.BreakerThreshold, cfg.Laravel.BreakerCooldown)
+	}
+
 	return &LaravelClient{
-		baseURL: baseURL,
-		timeout: cfg.Laravel.Timeout,
-		apiKey:  apiKey,
+		baseURL:       baseURL,
+		timeout:       cfg.Laravel.Timeout,
+		apiKey:        cfg.Laravel.APIKey,
+		tenantAPIKeys: cfg.Laravel.TenantAPIKeys,
+		insecureTLS:   cfg.Laravel.InsecureSkipVerify,
 		client: &http.Client{
 			Timeout:   cfg.Laravel.Timeout,
-			Transport: tr,
+			Transport: metrics.InstrumentTransport("laravel", tracing.Transport(tr)),
 		},
+		retryAttempts: retryAttempts,
+		retryDelay:    retryDelay,
+		breakers:      breakers,
+		cache:         c,
+		metadataTTL:   cfg.Laravel.ChannelCacheTTL,
+		staleTTL:      cfg.Laravel.StaleTTL,
+		secrets:       make(map[string]string),
 	}
 }
 
+// apiKeyFor returns the Laravel API key of a tenant, or the service key if it has none
+func (c *LaravelClient) apiKeyFor(tenantID int) string {
+	if key := c.tenantAPIKeys[tenantID]; key != "" {
+		return key
+	}
+	return c.apiKey
+}
+
 // GetAdDecision calls Laravel /ads/decision endpoint
 func (c *LaravelClient) GetAdDecision(ctx context.Context, req models.AdDecisionRequest) (*models.AdDecisionResponse, error) {
+	ctx, span := tracing.Start(ctx, "laravel.GetAdDecision",
+		attribute.String("ad_break.id", req.AdBreakID), attribute.String("ad_break.position", req.Position))
+	resp, err := c.getAdDecision(ctx, req)
+	if err == nil {
+		span.SetAttributes(attribute.Int("ads", len(resp.Data.Ads)))
+	}
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (c *LaravelClient) getAdDecision(ctx context.Context, req models.AdDecisionRequest) (*models.AdDecisionResponse, error) {
 	url := fmt.Sprintf("%s/api/v1/ads/decision", c.baseURL)
 
 	reqBody, err := json.Marshal(req)
@@ -66,9 +127,9 @@ func (c *LaravelClient) GetAdDecision(ctx context.Context, req models.AdDecision
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-API-Key", c.apiKey)
+	httpReq.Header.Set("X-API-Key", c.apiKeyFor(req.TenantID))
 
-	resp, err := c.client.Do(httpReq)
+	resp, err := c.do(httpReq, endpointAdDecision)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -89,6 +150,24 @@ func (c *LaravelClient) GetAdDecision(ctx context.Context, req models.AdDecision
 
 // GetChannelConfig gets channel ad break configuration from Laravel
 func (c *LaravelClient) GetChannelConfig(ctx context.Context, tenantID int, channelSlug string) (*models.ChannelConfig, error) {
+	ctx, span := tracing.Start(ctx, "laravel.GetChannelConfig", attribute.String("channel", channelSlug))
+	v, err := c.cachedLookup(ctx, endpointChannelConfig, fmt.Sprintf("laravel:channel_config:%d:%s", tenantID, channelSlug),
+		func(data []byte) (interface{}, error) {
+			var channelConfig models.ChannelConfig
+			err := json.Unmarshal(data, &channelConfig)
+			return &channelConfig, err
+		},
+		func(ctx context.Context) (interface{}, error) {
+			return c.getChannelConfig(ctx, tenantID, channelSlug)
+		})
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return v.(*models.ChannelConfig), nil
+}
+
+func (c *LaravelClient) getChannelConfig(ctx context.Context, tenantID int, channelSlug string) (*models.ChannelConfig, error) {
 	url := fmt.Sprintf("%s/channels/%s/config", c.baseURL, channelSlug)
 
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -96,10 +175,10 @@ func (c *LaravelClient) GetChannelConfig(ctx context.Context, tenantID int, chan
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	httpReq.Header.Set("X-API-Key", c.apiKey)
+	httpReq.Header.Set("X-API-Key", c.apiKeyFor(tenantID))
 	httpReq.Header.Set("X-Tenant-ID", fmt.Sprintf("%d", tenantID))
 
-	resp, err := c.client.Do(httpReq)
+	resp, err := c.do(httpReq, endpointChannelConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -122,6 +201,16 @@ func (c *LaravelClient) GetChannelConfig(ctx context.Context, tenantID int, chan
 
 // SendTrackingEvent sends tracking event to Laravel
 func (c *LaravelClient) SendTrackingEvent(ctx context.Context, event models.TrackingEvent) error {
+	err := c.sendTrackingEvent(ctx, event)
+	if err != nil {
+		metrics.TrackingEvent(event.EventType, metrics.TrackingFailed)
+	} else {
+		metrics.TrackingEvent(event.EventType, metrics.TrackingSent)
+	}
+	return err
+}
+
+func (c *LaravelClient) sendTrackingEvent(ctx context.Context, event models.TrackingEvent) error {
 	url := fmt.Sprintf("%s/api/v1/tracking/events", c.baseURL)
 
 	reqBody := map[string]interface{}{
@@ -139,9 +228,9 @@ func (c *LaravelClient) SendTrackingEvent(ctx context.Context, event models.Trac
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-API-Key", c.apiKey)
+	httpReq.Header.Set("X-API-Key", c.apiKeyFor(event.TenantID))
 
-	resp, err := c.client.Do(httpReq)
+	resp, err := c.do(httpReq, endpointTracking)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -154,3 +243,67 @@ func (c *LaravelClient) SendTrackingEvent(ctx context.Context, event models.Trac
 
 	return nil
 }
+
+// SendAvailRecord sends an avail accounting record to the tracking pipeline
+func (c *LaravelClient) SendAvailRecord(ctx context.Context, record models.AvailRecord) error {
+	url := fmt.Sprintf("%s/api/v1/tracking/avails", c.baseURL)
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"avails": []models.AvailRecord{record},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal avail: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKeyFor(record.TenantID))
+
+	resp, err := c.do(httpReq, endpointAvails)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// Ping checks that the Laravel API is reachable and accepts our API key.
+// It looks up a channel that doesn't exist: any answer but an auth failure or
+// a server error means the API is up.
+func (c *LaravelClient) Ping(ctx context.Context) error {
+	url := fmt.Sprintf("%s/api/v1/channels/_health/_health", c.baseURL)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("API key rejected (status %d)", resp.StatusCode)
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+)
+
+// cachedMetadata is the cache envelope of channel metadata
+type cachedMetadata struct {
+	Data      json.RawMessage `json:"data"`
+	FetchedAt time.Time       `json:"fetched_at"`
+}
+
+// cachedLookup returns the metadata at key, asking Laravel (once for all concurrent
+// callers) when there is no fresh copy. A stale copy is served while Laravel is
+// unavailable; definitive answers such as a 404 are returned as is.
+func (c *LaravelClient) cachedLookup(ctx context.Context, endpoint, key string,
+	decode func(data []byte) (interface{}, error), fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if c.cache == nil || c.metadataTTL <= 0 {
+		return fetch(ctx)
+	}
+
+	stale, fetchedAt, hasStale := c.getCachedMetadata(ctx, key, decode)
+	if hasStale && time.Since(fetchedAt) < c.metadataTTL {
+		return stale, nil
+	}
+
+	// Detach from the caller's cancellation: other requests may be waiting on this flight
+	flightCtx := context.WithoutCancel(ctx)
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		v, err := fetch(flightCtx)
+		if err != nil {
+			return nil, err
+		}
+		c.setCachedMetadata(flightCtx, key, v)
+		return v, nil
+	})
+	if err == nil {
+		return v, nil
+	}
+
+	if hasStale && errors.Is(err, ErrUnavailable) {
+		metrics.LaravelStaleServed.WithLabelValues(endpoint).Inc()
+		logging.FromContext(ctx).Warn("Laravel unavailable, serving cached metadata",
+			"key", key, "age", time.Since(fetchedAt).Round(time.Second).String(), "error", err)
+		return stale, nil
+	}
+	return nil, err
+}
+
+func (c *LaravelClient) getCachedMetadata(ctx context.Context, key string, decode func(data []byte) (interface{}, error)) (interface{}, time.Time, bool) {
+	raw, err := c.cache.Get(ctx, key)
+	if err != nil || raw == "" {
+		return nil, time.Time{}, false
+	}
+
+	var cached cachedMetadata
+	if err := json.Unmarshal([]byte(raw), &cached); err != nil {
+		return nil, time.Time{}, false
+	}
+	v, err := decode(cached.Data)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+
+	return v, cached.FetchedAt, true
+}
+
+func (c *LaravelClient) setCachedMetadata(ctx context.Context, key string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	envelope, err := json.Marshal(cachedMetadata{Data: data, FetchedAt: time.Now()})
+	if err != nil {
+		return
+	}
+
+	if err := c.cache.Set(ctx, key, string(envelope), c.metadataTTL+c.staleTTL); err != nil {
+		logging.FromContext(ctx).Warn("Failed to cache channel metadata", "key", key, "error", err)
+	}
+}
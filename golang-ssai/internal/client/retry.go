@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+)
+
+// ErrUnavailable wraps errors meaning Laravel couldn't answer: network errors, 5xx and
+// 429 responses (after retries) and open circuit breakers
+var ErrUnavailable = errors.New("laravel unavailable")
+
+// Laravel endpoints, each with its own circuit breaker
+const (
+	endpointChannel       = "channel"
+	endpointChannelConfig = "channel_config"
+	endpointAdDecision    = "ad_decision"
+	endpointTracking      = "tracking"
+	endpointAvails        = "avails"
+)
+
+// maxRetryDelay caps the backoff between attempts
+const maxRetryDelay = 2 * time.Second
+
+// do sends req through the endpoint's circuit breaker, retrying network errors, 5xx and
+// 429 responses with jittered exponential backoff. Responses it returns are below 500
+// (and not 429); the caller closes them.
+func (c *LaravelClient) do(req *http.Request, endpoint string) (*http.Response, error) {
+	breaker := c.breakers[endpoint]
+	if !breaker.allow() {
+		return nil, fmt.Errorf("%w: circuit breaker open for %s", ErrUnavailable, endpoint)
+	}
+
+	ctx := req.Context()
+	var lastErr error
+	for attempt := 0; attempt < c.retryAttempts; attempt++ {
+		if attempt > 0 {
+			metrics.LaravelRetries.WithLabelValues(endpoint).Inc()
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				breaker.release()
+				return nil, err
+			}
+		}
+
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				breaker.release()
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := c.client.Do(attemptReq)
+		if err != nil {
+			if ctx.Err() != nil {
+				breaker.release()
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			lastErr = fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+			continue
+		}
+
+		breaker.record(true)
+		return resp, nil
+	}
+
+	breaker.record(false)
+	return nil, fmt.Errorf("%w: %v", ErrUnavailable, lastErr)
+}
+
+// backoff returns the delay before a retry: retry_delay doubled per attempt, capped,
+// with half of it jittered so instances don't retry in lockstep
+func (c *LaravelClient) backoff(attempt int) time.Duration {
+	delay := c.retryDelay << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
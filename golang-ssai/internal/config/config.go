@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/fast-ads-backend/golang-ssai/pkg/urlrewrite"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,7 +17,21 @@ type Config struct {
 	Logging     LoggingConfig     `yaml:"logging"`
 	Metrics     MetricsConfig     `yaml:"metrics"`
 	RateLimiting RateLimitingConfig `yaml:"rate_limiting"`
-	Origins     map[string]string `yaml:"origins"`
+	Creatives   CreativeConfig    `yaml:"creatives"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Slate       SlateConfig       `yaml:"slate"`
+	Stitching   StitchingConfig   `yaml:"stitching"`
+	Degradation DegradationConfig `yaml:"degradation"`
+	OriginFailover OriginFailoverConfig `yaml:"origin_failover"`
+	PlaylistHealth PlaylistHealthConfig `yaml:"playlist_health"`
+	SegmentURLs SegmentURLConfig `yaml:"segment_urls"`
+	HostRewrites HostRewriteConfig `yaml:"host_rewrites"`
+	Health      HealthConfig      `yaml:"health"`
+	Avails      AvailConfig       `yaml:"avails"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Tracking    TrackingConfig    `yaml:"tracking"`
+	Channels    map[string]ChannelSettings `yaml:"channels"` // keyed by "tenant/channel"
+	Origins     map[string]string `yaml:"origins"` // origin CDN base URL by tenant ("default" for the rest)
 }
 
 type ServerConfig struct {
@@ -24,14 +39,23 @@ type ServerConfig struct {
 	Port         int           `yaml:"port"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IPs or CIDRs of the load balancers allowed to set X-Forwarded-For / X-Real-IP
+	// (and X-Forwarded-Proto); with none, the client IP is the connection's peer
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type LaravelConfig struct {
 	BaseURL      string        `yaml:"base_url"`
-	APIKey       string        `yaml:"api_key"`
+	APIKey       string        `yaml:"api_key"` // channel lookups, health checks and tenants without their own key
+	TenantAPIKeys map[int]string `yaml:"tenant_api_keys"` // per-tenant keys for tenant-scoped calls, by tenant ID
 	Timeout      time.Duration `yaml:"timeout"`
-	RetryAttempts int          `yaml:"retry_attempts"`
-	RetryDelay   time.Duration `yaml:"retry_delay"`
+	RetryAttempts int          `yaml:"retry_attempts"` // attempts per call, including the first
+	RetryDelay   time.Duration `yaml:"retry_delay"`    // first backoff, doubled per retry and jittered
+	BreakerThreshold int           `yaml:"breaker_threshold"` // consecutive failures opening an endpoint's circuit (default 5)
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // how long a circuit stays open before a probe (default 30s)
+	ChannelCacheTTL  time.Duration `yaml:"channel_cache_ttl"` // channel info and config served from cache; 0 disables
+	StaleTTL         time.Duration `yaml:"stale_ttl"`         // then served stale while Laravel is unavailable
+	InsecureSkipVerify bool        `yaml:"insecure_skip_verify"` // development only; URL signing secrets are refused
 }
 
 type RedisConfig struct {
@@ -40,17 +64,47 @@ type RedisConfig struct {
 	DB          int    `yaml:"db"`
 	PoolSize    int    `yaml:"pool_size"`
 	MinIdleConns int   `yaml:"min_idle_conns"`
+
+	Mode             string         `yaml:"mode"`              // single (default), sentinel or cluster
+	Addrs            []string       `yaml:"addrs"`             // sentinel or cluster node addresses
+	MasterName       string         `yaml:"master_name"`       // sentinel mode
+	SentinelPassword string         `yaml:"sentinel_password"` // sentinel mode, if the sentinels require auth
+	TLS              RedisTLSConfig `yaml:"tls"`
+}
+
+// Redis deployment modes
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
+type RedisTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`     // PEM bundle; system roots if empty
+	ServerName         string `yaml:"server_name"` // defaults to the host being dialed
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
 type CacheConfig struct {
 	ManifestTTL    time.Duration `yaml:"manifest_ttl"`
 	AdDecisionTTL  time.Duration `yaml:"ad_decision_ttl"`
 	VASTTTL        time.Duration `yaml:"vast_ttl"`
+	AdDecisionPrefetchAhead time.Duration `yaml:"ad_decision_prefetch_ahead"` // refresh cached decisions this long before they expire
+	PrefetchWorkers         int           `yaml:"prefetch_workers"`
+	StaticPrefetchAhead     time.Duration `yaml:"static_prefetch_ahead"` // prefetch decisions of static breaks scheduled this far past the window
+	Backend                 string        `yaml:"backend"`            // redis (default), memory or tiered
+	MemoryMaxEntries        int           `yaml:"memory_max_entries"` // in-memory LRU size (memory and tiered backends)
+	NearTTL                 time.Duration `yaml:"near_ttl"`           // longest an in-memory copy is served (tiered backend)
 }
 
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
+	// Debug logs of a share of requests when level is above debug, per tenant
+	// (DebugTenants) or for any tenant (DebugSampleRate), from 0 to 1
+	DebugSampleRate float64            `yaml:"debug_sample_rate"`
+	DebugTenants    map[string]float64 `yaml:"debug_tenants"`
 }
 
 type MetricsConfig struct {
@@ -60,7 +114,237 @@ type MetricsConfig struct {
 
 type RateLimitingConfig struct {
 	Enabled           bool `yaml:"enabled"`
-	RequestsPerMinute int  `yaml:"requests_per_minute"`
+	RequestsPerMinute int  `yaml:"requests_per_minute"` // per client IP on manifests, unless manifest.per_ip is set
+	// Backend holding the token buckets: memory (per instance, default) or redis (cluster-wide)
+	Backend  string         `yaml:"backend"`
+	Manifest RateLimitRules `yaml:"manifest"`
+	Tracking RateLimitRules `yaml:"tracking"`
+}
+
+// RateLimitRules are the token buckets applied to one group of endpoints
+type RateLimitRules struct {
+	PerIP      RateLimit `yaml:"per_ip"`
+	PerTenant  RateLimit `yaml:"per_tenant"`
+	PerSession RateLimit `yaml:"per_session"`
+}
+
+// RateLimit is a token bucket refilled at RequestsPerMinute, holding up to Burst
+// requests (RequestsPerMinute by default); 0 requests per minute disables it
+type RateLimit struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+}
+
+// CreativeConfig controls on-the-fly conditioning of MP4-only creatives into HLS
+type CreativeConfig struct {
+	Enabled         bool              `yaml:"enabled"`
+	FFmpegPath      string            `yaml:"ffmpeg_path"`
+	OutputDir       string            `yaml:"output_dir"`
+	PublicURL       string            `yaml:"public_url"` // base URL the output dir is served under
+	Workers         int               `yaml:"workers"`
+	QueueSize       int               `yaml:"queue_size"`
+	JobTimeout      time.Duration     `yaml:"job_timeout"`
+	SegmentDuration int               `yaml:"segment_duration"` // used when the origin doesn't advertise one
+	FrameRate       float64           `yaml:"frame_rate"`       // used when the origin doesn't advertise one
+	SlateURL        string            `yaml:"slate_url"`        // HLS slate played while a creative is conditioning
+	RegistryTTL     time.Duration     `yaml:"registry_ttl"`     // 0 keeps registry entries forever
+	Ladder          []RenditionConfig `yaml:"ladder"`           // used when the origin is a bare media playlist
+}
+
+// RenditionConfig describes a single rendition of a conditioned creative
+type RenditionConfig struct {
+	Width   int `yaml:"width"`
+	Height  int `yaml:"height"`
+	Bitrate int `yaml:"bitrate"` // video bitrate in bits per second
+}
+
+// AdminConfig protects the /admin endpoints
+type AdminConfig struct {
+	APIKey string `yaml:"api_key"` // required in X-Admin-Key; admin endpoints are disabled when empty
+}
+
+// StitchingConfig controls how ad pods are fitted into breaks
+type StitchingConfig struct {
+	PodTolerance   time.Duration `yaml:"pod_tolerance"`   // how far a pod may overrun the signaled avail
+	MaxConcurrency int           `yaml:"max_concurrency"` // decisions/VAST/ad manifests resolved in parallel per request
+	Deadline       time.Duration `yaml:"deadline"`        // ads not resolved by then are dropped (or slated)
+}
+
+// HealthConfig controls the readiness probe
+type HealthConfig struct {
+	Timeout   time.Duration `yaml:"timeout"`    // per dependency check
+	OriginURL string        `yaml:"origin_url"` // sample origin playlist checked for readiness (optional)
+}
+
+// TracingConfig controls OpenTelemetry tracing
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Exporter    string  `yaml:"exporter"`     // otlp (default) or stdout
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP collector host:port (OTEL_EXPORTER_OTLP_ENDPOINT if empty)
+	Insecure    bool    `yaml:"insecure"`     // plain HTTP to the collector
+	SampleRatio float64 `yaml:"sample_ratio"` // share of new traces sampled (default 1); sampled parents are always followed
+	ServiceName string  `yaml:"service_name"`
+}
+
+// TrackingConfig controls authentication of the /tracking endpoints. Events are
+// accepted with a session token issued alongside a manifest or with a tenant API key.
+type TrackingConfig struct {
+	TokenSecret string         `yaml:"token_secret"` // signs session tokens; none are issued when empty
+	TokenTTL    time.Duration  `yaml:"token_ttl"`    // how long a session token is accepted (default 6h)
+	APIKeys     map[int]string `yaml:"api_keys"`     // tenant API keys for server-to-server events, by tenant ID
+}
+
+// AvailConfig controls avail accounting
+type AvailConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Forward   bool          `yaml:"forward"`   // also send each avail record to Laravel's tracking API
+	Retention time.Duration `yaml:"retention"` // how long hourly aggregates are kept
+}
+
+// Empty break policies
+const (
+	EmptyBreakPassthrough = "passthrough" // play content through an empty break
+	EmptyBreakSlate       = "slate"       // fill an empty break entirely with slate
+)
+
+// SlateConfig configures the filler played in underfilled or empty ad breaks
+type SlateConfig struct {
+	URL              string `yaml:"url"`                // short looped HLS media playlist
+	EmptyBreakPolicy string `yaml:"empty_break_policy"` // passthrough (default) or slate
+}
+
+// OriginFailoverConfig controls failover between a channel's origins
+type OriginFailoverConfig struct {
+	FailureThreshold     int           `yaml:"failure_threshold"`      // consecutive failed fetches before an origin is skipped (default 1)
+	StaleTargetDurations float64       `yaml:"stale_target_durations"` // target durations without a new segment before a live playlist is stale (default 3)
+	FailbackAfter        time.Duration `yaml:"failback_after"`         // how long a failed origin is skipped and a backup kept before failing back (default 30s)
+}
+
+// PlaylistHealthConfig controls the checks run on every origin playlist poll
+type PlaylistHealthConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	PDTGapTolerance time.Duration `yaml:"pdt_gap_tolerance"` // PDT jumps between consecutive segments beyond this are gaps (default 1s)
+	FailoverOn      []string      `yaml:"failover_on"`       // issues that also mark the origin unhealthy (stale playlists always do)
+	AlertWebhookURL string        `yaml:"alert_webhook_url"` // receives a JSON POST when a channel develops an issue (optional)
+	StatusTTL       time.Duration `yaml:"status_ttl"`        // how long a channel's status is kept after its last poll (default 1h)
+}
+
+// Segment URL strategies
+const (
+	SegmentURLPassthrough = "passthrough" // segments are fetched from the origin / ad CDN directly
+	SegmentURLCDN         = "cdn"         // segment URLs are mapped onto CDN prefixes by cdn_rules
+	SegmentURLProxy       = "proxy"       // segments are proxied through this service
+)
+
+// SegmentURLConfig controls where players fetch segments from. Tenants may override it
+// under tenants.
+type SegmentURLConfig struct {
+	Strategy     string                      `yaml:"strategy"`       // passthrough (default), cdn or proxy
+	CDNRules     []CDNRule                   `yaml:"cdn_rules"`      // cdn: the first rule matching a URL rewrites it
+	ProxyBaseURL string                      `yaml:"proxy_base_url"` // proxy: public URL of this service (the request's host if empty)
+	ProxySecret  string                      `yaml:"proxy_secret"`   // proxy: signs proxied URLs; segments are passed through when empty
+	ProxyURLTTL  time.Duration               `yaml:"proxy_url_ttl"`  // proxy: how long proxied URLs are valid
+	Tenants      map[string]SegmentURLConfig `yaml:"tenants"`        // per-tenant overrides
+}
+
+// CDNRule maps segment URLs under an origin or ad host prefix onto a CDN prefix
+type CDNRule struct {
+	Match   string `yaml:"match"`   // URL prefix, e.g. "http://103.152.36.106/antv/"
+	Replace string `yaml:"replace"` // e.g. "https://cdn.example.com/antv/"
+}
+
+// SegmentURLsFor returns the segment URL settings of a tenant with service defaults applied
+func (c *Config) SegmentURLsFor(tenant string) SegmentURLConfig {
+	settings, ok := c.SegmentURLs.Tenants[tenant]
+	if !ok {
+		settings = c.SegmentURLs
+	}
+
+	if settings.Strategy == "" {
+		settings.Strategy = c.SegmentURLs.Strategy
+	}
+	if settings.Strategy == "" {
+		settings.Strategy = SegmentURLPassthrough
+	}
+	if settings.CDNRules == nil {
+		settings.CDNRules = c.SegmentURLs.CDNRules
+	}
+	if settings.ProxyBaseURL == "" {
+		settings.ProxyBaseURL = c.SegmentURLs.ProxyBaseURL
+	}
+	if settings.ProxySecret == "" {
+		settings.ProxySecret = c.SegmentURLs.ProxySecret
+	}
+	if settings.ProxyURLTTL <= 0 {
+		settings.ProxyURLTTL = c.SegmentURLs.ProxyURLTTL
+	}
+	settings.Tenants = nil
+
+	return settings
+}
+
+// HostRewriteConfig rewrites origin, ad and VAST URLs and the URLs in their playlists,
+// e.g. an ad server's internal address to its public one
+type HostRewriteConfig struct {
+	Rules   urlrewrite.Rules            `yaml:"rules"`   // default rules
+	Tenants map[string]urlrewrite.Rules `yaml:"tenants"` // per-tenant rules, tried before the default ones
+}
+
+// HostRewritesFor returns the host rewrite rules of a tenant
+func (c *Config) HostRewritesFor(tenant string) urlrewrite.Rules {
+	tenantRules := c.HostRewrites.Tenants[tenant]
+	if len(tenantRules) == 0 {
+		return c.HostRewrites.Rules
+	}
+
+	rules := make(urlrewrite.Rules, 0, len(tenantRules)+len(c.HostRewrites.Rules))
+	return append(append(rules, tenantRules...), c.HostRewrites.Rules...)
+}
+
+// Degradation policies
+const (
+	DegradeToOrigin = "origin" // serve the unstitched origin playlist (or the last good one)
+	DegradeFail     = "fail"   // return an error rather than unmonetized content
+)
+
+// DegradationConfig controls what is served when stitching can't complete
+type DegradationConfig struct {
+	Policy      string        `yaml:"policy"`        // origin (default) or fail
+	LastGoodTTL time.Duration `yaml:"last_good_ttl"` // how long the last good playlist may stand in for a failed origin; 0 disables
+}
+
+// ChannelSettings overrides service defaults for a single channel
+type ChannelSettings struct {
+	Slate       SlateConfig       `yaml:"slate"`
+	Degradation DegradationConfig `yaml:"degradation"`
+	Origins     []string          `yaml:"origins"` // backup origins, tried in order after those from Laravel
+}
+
+// ChannelSettingsFor returns the settings of a channel with service defaults applied
+func (c *Config) ChannelSettingsFor(tenant, channel string) ChannelSettings {
+	settings := c.Channels[tenant+"/"+channel]
+
+	if settings.Slate.URL == "" {
+		settings.Slate.URL = c.Slate.URL
+	}
+	if settings.Slate.EmptyBreakPolicy == "" {
+		settings.Slate.EmptyBreakPolicy = c.Slate.EmptyBreakPolicy
+	}
+	if settings.Slate.EmptyBreakPolicy == "" {
+		settings.Slate.EmptyBreakPolicy = EmptyBreakPassthrough
+	}
+
+	if settings.Degradation.Policy == "" {
+		settings.Degradation.Policy = c.Degradation.Policy
+	}
+	if settings.Degradation.Policy == "" {
+		settings.Degradation.Policy = DegradeToOrigin
+	}
+	if settings.Degradation.LastGoodTTL == 0 {
+		settings.Degradation.LastGoodTTL = c.Degradation.LastGoodTTL
+	}
+
+	return settings
 }
 
 var GlobalConfig *Config
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/fast-ads-backend/golang-ssai/pkg/urlrewrite"
+)
+
+func TestHostRewritesFor(t *testing.T) {
+	defaultRule := urlrewrite.Rule{
+		Match:   urlrewrite.Pattern{Host: "*.example.com"},
+		Replace: urlrewrite.Pattern{Host: "default.example.net"},
+	}
+	tenantRule := urlrewrite.Rule{
+		Match:   urlrewrite.Pattern{Host: "origin.example.com"},
+		Replace: urlrewrite.Pattern{Host: "tenant.example.net"},
+	}
+	cfg := &Config{HostRewrites: HostRewriteConfig{
+		Rules:   urlrewrite.Rules{defaultRule},
+		Tenants: map[string]urlrewrite.Rules{"acme": {tenantRule}},
+	}}
+
+	tests := []struct {
+		tenant string
+		in     string
+		want   string
+	}{
+		{"acme", "http://origin.example.com/a.ts", "http://tenant.example.net/a.ts"}, // tenant rule first
+		{"acme", "http://edge.example.com/a.ts", "http://default.example.net/a.ts"},  // falls back to defaults
+		{"other", "http://origin.example.com/a.ts", "http://default.example.net/a.ts"},
+	}
+	for _, tt := range tests {
+		if got := cfg.HostRewritesFor(tt.tenant).Apply(tt.in); got != tt.want {
+			t.Errorf("HostRewritesFor(%q).Apply(%q) = %q, want %q", tt.tenant, tt.in, got, tt.want)
+		}
+	}
+
+	rules := cfg.HostRewritesFor("acme")
+	if len(rules) != 2 || rules[0] != tenantRule || rules[1] != defaultRule {
+		t.Errorf("HostRewritesFor(acme) = %v, want tenant rules then defaults", rules)
+	}
+}
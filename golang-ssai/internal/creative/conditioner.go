@@ -0,0 +1,386 @@
+package creative
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+)
+
+// Entry statuses
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// Conditioner transcodes MP4-only creatives into HLS ladders with a local ffmpeg.
+// Output is content-addressed by creative key and profile so a creative is only
+// ever transcoded once per channel encoding. Job state lives in the Registry.
+type Conditioner struct {
+	config   config.CreativeConfig
+	registry *Registry
+	queue    chan conditionJob
+
+	mu       sync.Mutex
+	inflight map[string]bool // entries queued or running on this instance
+}
+
+// conditionJob is a queued entry and the logger of the request that queued it
+type conditionJob struct {
+	entry *Entry
+	log   *slog.Logger
+}
+
+// NewConditioner creates a conditioner and starts its worker pool
+func NewConditioner(cfg config.CreativeConfig, registry *Registry) *Conditioner {
+	if cfg.FFmpegPath == "" {
+		cfg.FFmpegPath = "ffmpeg"
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if cfg.JobTimeout <= 0 {
+		cfg.JobTimeout = 5 * time.Minute
+	}
+
+	c := &Conditioner{
+		config:   cfg,
+		registry: registry,
+		queue:    make(chan conditionJob, cfg.QueueSize),
+		inflight: make(map[string]bool),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		go c.worker()
+	}
+
+	return c
+}
+
+// Resolve returns the HLS media playlist URL of a conditioned creative.
+// If the creative hasn't been conditioned for this profile yet, a job is queued
+// and ready is false; callers should fall back to the slate until it is.
+func (c *Conditioner) Resolve(ctx context.Context, key, universalAdID, mediaURL string, profile Profile) (manifestURL string, ready bool) {
+	// MediaFile URLs come from third-party VAST: never let ffmpeg read anything but the web
+	if !isWebURL(mediaURL) {
+		logging.FromContext(ctx).Warn("Refusing to condition creative with a non-HTTP media URL", "creative", key, "url", mediaURL)
+		return "", false
+	}
+	profileID := ProfileID(profile)
+
+	entry, err := c.registry.Get(ctx, key, profileID)
+	if err != nil {
+		logging.FromContext(ctx).Error("Creative registry lookup failed", "creative", key, "error", err)
+		return "", false
+	}
+
+	if entry == nil {
+		entry = &Entry{
+			Key:           key,
+			ProfileID:     profileID,
+			UniversalAdID: universalAdID,
+			MediaURL:      mediaURL,
+			Profile:       profile,
+			Status:        StatusPending,
+		}
+		// Output may already exist from a previous run
+		if c.hasOutput(entry) {
+			c.markReady(ctx, entry)
+			return entry.ManifestURL, true
+		}
+		if err := c.registry.Put(ctx, entry); err != nil {
+			logging.FromContext(ctx).Error("Failed to register creative", "creative", key, "error", err)
+		}
+		c.enqueue(ctx, entry)
+		return "", false
+	}
+
+	switch entry.Status {
+	case StatusReady:
+		return entry.ManifestURL, true
+	case StatusPending:
+		// Re-queue jobs abandoned by an instance that went away mid-transcode
+		if time.Since(entry.UpdatedAt) > 2*c.config.JobTimeout {
+			c.enqueue(ctx, entry)
+		}
+	}
+
+	return "", false
+}
+
+// Requeue forces every profile entry of a creative to be conditioned again
+func (c *Conditioner) Requeue(ctx context.Context, key string) (int, error) {
+	entries, err := c.registry.Find(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		entry.Status = StatusPending
+		entry.Error = ""
+		if err := c.registry.Put(ctx, entry); err != nil {
+			return 0, err
+		}
+		c.enqueue(ctx, entry)
+	}
+
+	return len(entries), nil
+}
+
+// Purge removes every profile entry of a creative along with its conditioned output, so
+// the next decision conditions it again, and returns how many entries were removed
+func (c *Conditioner) Purge(ctx context.Context, key string) (int, error) {
+	entries, err := c.registry.Find(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	// Output left on disk would be picked up again as ready by Resolve
+	for _, entry := range entries {
+		if err := os.RemoveAll(c.jobDir(jobID(entry))); err != nil {
+			return 0, fmt.Errorf("failed to remove output of creative %s: %w", key, err)
+		}
+	}
+
+	return c.registry.Purge(ctx, key)
+}
+
+// Registry returns the registry the conditioner records jobs in
+func (c *Conditioner) Registry() *Registry {
+	return c.registry
+}
+
+// SlateURL returns the slate played while creatives are conditioning
+func (c *Conditioner) SlateURL() string {
+	return c.config.SlateURL
+}
+
+// jobID returns the content address of a creative conditioned for a profile
+func jobID(entry *Entry) string {
+	sum := sha256.Sum256([]byte(entry.Key + "\n" + entry.Profile.Fingerprint()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Conditioner) enqueue(ctx context.Context, entry *Entry) {
+	log := logging.FromContext(ctx)
+	// Entries registered before media URLs were checked may still be requeued
+	if !isWebURL(entry.MediaURL) {
+		log.Warn("Refusing to queue creative with a non-HTTP media URL", "creative", entry.Key, "media_url", entry.MediaURL)
+		return
+	}
+	id := jobID(entry)
+
+	c.mu.Lock()
+	if c.inflight[id] {
+		c.mu.Unlock()
+		return
+	}
+	c.inflight[id] = true
+	c.mu.Unlock()
+
+	select {
+	case c.queue <- conditionJob{entry: entry, log: log.With("creative", entry.Key, "job", id)}:
+		log.Info("Queued creative conditioning job", "creative", entry.Key, "job", id, "media_url", entry.MediaURL)
+	default:
+		// Queue full - the next decision retries it once the entry goes stale
+		log.Warn("Creative conditioning queue full, dropping job", "creative", entry.Key, "media_url", entry.MediaURL)
+		c.mu.Lock()
+		delete(c.inflight, id)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Conditioner) worker() {
+	for job := range c.queue {
+		entry := job.entry
+		id := jobID(entry)
+		err := c.transcode(id, entry)
+
+		// Jobs outlive their request: keep its logger, not its cancellation
+		ctx, cancel := context.WithTimeout(logging.WithLogger(context.Background(), job.log), 5*time.Second)
+		log := logging.FromContext(ctx)
+		if err != nil {
+			log.Error("Creative conditioning failed", "media_url", entry.MediaURL, "error", err)
+			entry.Status = StatusFailed
+			entry.Error = err.Error()
+			if err := c.registry.Put(ctx, entry); err != nil {
+				log.Error("Failed to update creative", "error", err)
+			}
+		} else {
+			c.markReady(ctx, entry)
+			log.Info("Creative conditioned", "media_url", entry.MediaURL, "renditions", len(entry.Ladder), "duration", entry.Duration)
+		}
+		cancel()
+
+		c.mu.Lock()
+		delete(c.inflight, id)
+		c.mu.Unlock()
+	}
+}
+
+// markReady fills in the conditioned output details of an entry and stores it
+func (c *Conditioner) markReady(ctx context.Context, entry *Entry) {
+	id := jobID(entry)
+
+	entry.Status = StatusReady
+	entry.Error = ""
+	entry.ManifestURL = c.renditionURL(id, 0)
+	entry.Ladder = entry.Profile.Renditions
+	entry.Duration = playlistDuration(filepath.Join(c.jobDir(id), "0", "index.m3u8"))
+
+	if err := c.registry.Put(ctx, entry); err != nil {
+		logging.FromContext(ctx).Error("Failed to update creative", "creative", entry.Key, "error", err)
+	}
+}
+
+func (c *Conditioner) hasOutput(entry *Entry) bool {
+	_, err := os.Stat(filepath.Join(c.jobDir(jobID(entry)), "master.m3u8"))
+	return err == nil
+}
+
+// transcode runs ffmpeg once per rendition into a temporary directory and
+// moves the result into its content-addressed location when complete
+func (c *Conditioner) transcode(id string, entry *Entry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.JobTimeout)
+	defer cancel()
+
+	finalDir := c.jobDir(id)
+	if err := os.MkdirAll(filepath.Dir(finalDir), 0o755); err != nil {
+		return fmt.Errorf("failed to create output dir: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(finalDir), id+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, r := range entry.Profile.Renditions {
+		renditionDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(renditionDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create rendition dir: %w", err)
+		}
+
+		args := c.ffmpegArgs(entry.MediaURL, entry.Profile, r, renditionDir)
+		cmd := exec.CommandContext(ctx, c.config.FFmpegPath, args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("ffmpeg failed for %dx%d: %w: %s", r.Width, r.Height, err, tail(string(out), 500))
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "master.m3u8"), []byte(masterPlaylist(entry.Profile)), 0o644); err != nil {
+		return fmt.Errorf("failed to write master playlist: %w", err)
+	}
+
+	os.RemoveAll(finalDir)
+	if err := os.Rename(tmpDir, finalDir); err != nil {
+		return fmt.Errorf("failed to publish conditioned creative: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Conditioner) ffmpegArgs(input string, profile Profile, r Rendition, outDir string) []string {
+	gop := int(profile.FrameRate*float64(profile.SegmentDuration) + 0.5)
+
+	videoCodec := []string{"-c:v", "libx264", "-profile:v", "high"}
+	if profile.VideoCodec == CodecHEVC {
+		videoCodec = []string{"-c:v", "libx265", "-tag:v", "hvc1"}
+	}
+
+	args := []string{
+		"-y", "-hide_banner", "-loglevel", "error",
+		// Only fetch over HTTP(S), and demux as MP4 so a crafted "MP4" can't switch
+		// ffmpeg to its HLS or concat demuxers (which would follow file: or internal URLs)
+		"-protocol_whitelist", "http,https,tcp,tls",
+		"-f", "mov",
+		"-i", input,
+		"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2", r.Width, r.Height, r.Width, r.Height),
+		"-r", fmt.Sprintf("%.3f", profile.FrameRate),
+	}
+	args = append(args, videoCodec...)
+	args = append(args,
+		"-b:v", fmt.Sprintf("%d", r.Bitrate),
+		"-maxrate", fmt.Sprintf("%d", r.Bitrate),
+		"-bufsize", fmt.Sprintf("%d", r.Bitrate*2),
+		"-g", fmt.Sprintf("%d", gop),
+		"-keyint_min", fmt.Sprintf("%d", gop),
+		"-sc_threshold", "0",
+		"-c:a", "aac", "-b:a", "128k", "-ar", "48000", "-ac", "2",
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", profile.SegmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outDir, "seg_%03d.ts"),
+		filepath.Join(outDir, "index.m3u8"),
+	)
+
+	return args
+}
+
+// isWebURL reports whether rawURL is an absolute http or https URL
+func isWebURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (c *Conditioner) jobDir(id string) string {
+	return filepath.Join(c.config.OutputDir, id[:2], id)
+}
+
+func (c *Conditioner) renditionURL(id string, rendition int) string {
+	base := strings.TrimSuffix(c.config.PublicURL, "/")
+	return fmt.Sprintf("%s/%s/%s/%d/index.m3u8", base, id[:2], id, rendition)
+}
+
+func masterPlaylist(profile Profile) string {
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	sb.WriteString("#EXT-X-VERSION:3\n")
+	for i, r := range profile.Renditions {
+		sb.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n", r.Bitrate+128000, r.Width, r.Height))
+		sb.WriteString(fmt.Sprintf("%d/index.m3u8\n", i))
+	}
+	return sb.String()
+}
+
+// playlistDuration sums the segment durations of a media playlist on disk
+func playlistDuration(path string) float64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	m, err := hls.ParseManifest(string(data))
+	if err != nil {
+		return 0
+	}
+
+	var total float64
+	for _, seg := range m.Segments {
+		total += seg.Duration
+	}
+	return total
+}
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
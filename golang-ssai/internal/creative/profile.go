@@ -0,0 +1,122 @@
+package creative
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+)
+
+// Video codecs a creative can be conditioned into
+const (
+	CodecH264 = "h264"
+	CodecHEVC = "hevc"
+)
+
+// Rendition is a single step of a conditioned creative's HLS ladder
+type Rendition struct {
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	Bitrate int `json:"bitrate"`
+}
+
+// Profile describes the encoding a creative must match to be stitched into a channel
+type Profile struct {
+	VideoCodec      string      `json:"video_codec"`
+	FrameRate       float64     `json:"frame_rate"`
+	SegmentDuration int         `json:"segment_duration"`
+	Renditions      []Rendition `json:"renditions"`
+}
+
+// ProfileFromVariants derives a conditioning profile from the channel's master playlist variants.
+// Renditions are index-aligned with the variants, so the first rendition always matches the
+// first variant, which is the one the stitcher serves; variants without a RESOLUTION get the
+// default size. Falls back to the configured ladder when no variant has a resolution (e.g.
+// the origin is a bare media playlist).
+func ProfileFromVariants(variants []hls.Variant, targetDuration int, cfg config.CreativeConfig) Profile {
+	profile := Profile{
+		VideoCodec:      CodecH264,
+		FrameRate:       cfg.FrameRate,
+		SegmentDuration: targetDuration,
+	}
+	if profile.SegmentDuration <= 0 {
+		profile.SegmentDuration = cfg.SegmentDuration
+	}
+	if profile.SegmentDuration <= 0 {
+		profile.SegmentDuration = 6
+	}
+	if profile.FrameRate <= 0 {
+		profile.FrameRate = 25
+	}
+
+	fallback := defaultRendition(cfg)
+	for _, v := range variants {
+		if v.Width > 0 && v.Height > 0 {
+			profile.Renditions = variantRenditions(variants, fallback)
+			break
+		}
+	}
+
+	if len(variants) > 0 {
+		first := variants[0]
+		if first.FrameRate > 0 {
+			profile.FrameRate = first.FrameRate
+		}
+		codecs := strings.ToLower(first.Codecs)
+		if strings.Contains(codecs, "hvc1") || strings.Contains(codecs, "hev1") {
+			profile.VideoCodec = CodecHEVC
+		}
+	}
+
+	if len(profile.Renditions) == 0 {
+		for _, r := range cfg.Ladder {
+			profile.Renditions = append(profile.Renditions, Rendition{
+				Width:   r.Width,
+				Height:  r.Height,
+				Bitrate: r.Bitrate,
+			})
+		}
+	}
+	if len(profile.Renditions) == 0 {
+		profile.Renditions = []Rendition{fallback}
+	}
+
+	return profile
+}
+
+// variantRenditions returns one rendition per variant, sizing variants without a
+// resolution (audio-only or incomplete) like fallback
+func variantRenditions(variants []hls.Variant, fallback Rendition) []Rendition {
+	renditions := make([]Rendition, 0, len(variants))
+	for _, v := range variants {
+		r := Rendition{Width: v.Width, Height: v.Height, Bitrate: v.Bandwidth}
+		if r.Width == 0 || r.Height == 0 {
+			r.Width, r.Height = fallback.Width, fallback.Height
+		}
+		if r.Bitrate == 0 {
+			r.Bitrate = fallback.Bitrate
+		}
+		renditions = append(renditions, r)
+	}
+	return renditions
+}
+
+// defaultRendition is the first step of the configured ladder, or 720p
+func defaultRendition(cfg config.CreativeConfig) Rendition {
+	if len(cfg.Ladder) > 0 && cfg.Ladder[0].Width > 0 && cfg.Ladder[0].Height > 0 {
+		r := cfg.Ladder[0]
+		return Rendition{Width: r.Width, Height: r.Height, Bitrate: r.Bitrate}
+	}
+	return Rendition{Width: 1280, Height: 720, Bitrate: 3000000}
+}
+
+// Fingerprint returns a stable string identifying the profile, used for content addressing
+func (p Profile) Fingerprint() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s|%.3f|%d", p.VideoCodec, p.FrameRate, p.SegmentDuration))
+	for _, r := range p.Renditions {
+		sb.WriteString(fmt.Sprintf("|%dx%d@%d", r.Width, r.Height, r.Bitrate))
+	}
+	return sb.String()
+}
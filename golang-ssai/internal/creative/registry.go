@@ -0,0 +1,174 @@
+package creative
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/pkg/cachebust"
+)
+
+const registryPrefix = "creative:"
+
+// Entry is a creative conditioned (or being conditioned) for one encoding profile
+type Entry struct {
+	Key           string      `json:"key"`
+	ProfileID     string      `json:"profile_id"`
+	UniversalAdID string      `json:"universal_ad_id,omitempty"`
+	MediaURL      string      `json:"media_url"`
+	ManifestURL   string      `json:"manifest_url,omitempty"`
+	Profile       Profile     `json:"profile"`
+	Ladder        []Rendition `json:"ladder,omitempty"`
+	Duration      float64     `json:"duration,omitempty"`
+	Status        string      `json:"status"`
+	Error         string      `json:"error,omitempty"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// Key returns the normalized registry key of a creative.
+// The VAST UniversalAdId is preferred; otherwise the MediaFile URL is hashed
+// with its cache-busting query parameters removed.
+func Key(universalAdID, mediaURL string) string {
+	if id := strings.TrimSpace(universalAdID); id != "" && !strings.EqualFold(id, "unknown") {
+		return "uaid:" + strings.ToLower(id)
+	}
+
+	sum := sha256.Sum256([]byte(cachebust.Strip(mediaURL)))
+	return "url:" + hex.EncodeToString(sum[:16])
+}
+
+// ProfileID returns a short identifier for a profile
+func ProfileID(profile Profile) string {
+	sum := sha256.Sum256([]byte(profile.Fingerprint()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Registry stores conditioned creatives in the shared cache so every
+// instance knows which creatives have already been seen
+type Registry struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+// NewRegistry creates a creative registry; ttl of 0 keeps entries forever
+func NewRegistry(c cache.Cache, ttl time.Duration) *Registry {
+	return &Registry{
+		cache: c,
+		ttl:   ttl,
+	}
+}
+
+// Get returns the entry of a creative for a profile, or nil if it is unknown
+func (r *Registry) Get(ctx context.Context, key, profileID string) (*Entry, error) {
+	raw, err := r.cache.Get(ctx, entryKey(key, profileID))
+	if err == cache.ErrMiss {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read creative %s: %w", key, err)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode creative %s: %w", key, err)
+	}
+
+	return &entry, nil
+}
+
+// Put stores an entry
+func (r *Registry) Put(ctx context.Context, entry *Entry) error {
+	entry.UpdatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode creative %s: %w", entry.Key, err)
+	}
+
+	return r.cache.Set(ctx, entryKey(entry.Key, entry.ProfileID), string(data), r.ttl)
+}
+
+// Find returns every profile entry of a creative. Keys may contain ':' (UAIDs), so only
+// creative:<key>:<profile ID> keys count, not those of creatives whose key extends it.
+func (r *Registry) Find(ctx context.Context, key string) ([]*Entry, error) {
+	prefix := registryPrefix + key + ":"
+	return r.scan(ctx, prefix, func(k string) bool {
+		return isProfileID(strings.TrimPrefix(k, prefix))
+	})
+}
+
+// List returns every entry in the registry, most recently updated first
+func (r *Registry) List(ctx context.Context) ([]*Entry, error) {
+	entries, err := r.scan(ctx, registryPrefix, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+	})
+
+	return entries, nil
+}
+
+// Purge removes every profile entry of a creative and returns how many were removed
+func (r *Registry) Purge(ctx context.Context, key string) (int, error) {
+	entries, err := r.Find(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if err := r.cache.Delete(ctx, entryKey(entry.Key, entry.ProfileID)); err != nil {
+			return 0, fmt.Errorf("failed to purge creative %s: %w", key, err)
+		}
+	}
+
+	return len(entries), nil
+}
+
+// scan returns the entries under prefix whose keys pass match (all if nil)
+func (r *Registry) scan(ctx context.Context, prefix string, match func(key string) bool) ([]*Entry, error) {
+	keys, err := r.cache.Keys(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list creatives: %w", err)
+	}
+
+	entries := make([]*Entry, 0, len(keys))
+	for _, k := range keys {
+		if match != nil && !match(k) {
+			continue
+		}
+		raw, err := r.cache.Get(ctx, k)
+		if err != nil {
+			continue // expired or deleted between scan and get
+		}
+
+		var entry Entry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+// isProfileID reports whether s looks like a ProfileID (16 hex characters)
+func isProfileID(s string) bool {
+	if len(s) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func entryKey(key, profileID string) string {
+	return registryPrefix + key + ":" + profileID
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth protects admin endpoints with the configured admin API key.
+// Admin endpoints are disabled entirely when no key is configured.
+func AdminAuth(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Admin.APIKey == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API is disabled"})
+			return
+		}
+
+		key := c.GetHeader("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.Admin.APIKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin key"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/internal/parser"
+	"github.com/fast-ads-backend/golang-ssai/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// cueAvailSeenFor is how long a viewer's cue break counts as seen; cue break IDs are
+	// unique, so this only needs to outlast the break's stay in the playlist window
+	cueAvailSeenFor = time.Hour
+	// minStaticAvailSeenFor is the shortest a static break counts as seen
+	minStaticAvailSeenFor = 30 * time.Second
+)
+
+type AvailHandler struct {
+	recorder *service.AvailRecorder
+}
+
+func NewAvailHandler(recorder *service.AvailRecorder) *AvailHandler {
+	return &AvailHandler{recorder: recorder}
+}
+
+// Stats handles GET /admin/avails?tenant=&channel=&from=&to= (RFC3339, last 24 hours by default)
+func (h *AvailHandler) Stats(c *gin.Context) {
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC3339 time"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC3339 time"})
+			return
+		}
+	}
+
+	stats, err := h.recorder.Stats(c.Request.Context(), c.Query("tenant"), c.Query("channel"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    stats,
+		"total":   len(stats),
+	})
+}
+
+// recordAvails accounts for every break of a manifest request: how much of each avail
+// was filled with paid ads, padded with slate or left to the origin. Only breaks in
+// requested (by ID) count towards the requested seconds.
+func (h *ManifestHandler) recordAvails(ctx context.Context, tenant, channel string, channelInfo *models.ChannelInfo, adBreaks []models.AdBreak, requested map[string]bool, stitched []parser.AdBreakWithAds, hasSlate bool, v viewer) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	stitchedByID := make(map[string]parser.AdBreakWithAds, len(stitched))
+	for _, adBreak := range stitched {
+		stitchedByID[adBreak.ID] = adBreak
+	}
+
+	for _, adBreak := range adBreaks {
+		// A CUE-OUT at the live edge isn't an avail yet (only its decision was prefetched)
+		if adBreak.Type == "scte35" && !adBreak.SpanUnknown && adBreak.EndIndex <= adBreak.StartIndex {
+			continue
+		}
+
+		detected := float64(adBreak.Duration)
+		record := models.AvailRecord{
+			TenantID:        channelInfo.TenantID,
+			ChannelID:       channelInfo.ID,
+			Tenant:          tenant,
+			Channel:         channel,
+			SessionID:       v.SessionID,
+			BreakID:         adBreak.ID,
+			Source:          adBreak.Type,
+			Position:        adBreak.Position,
+			DetectedSeconds: detected,
+			AdIDs:           []int{},
+			Timestamp:       time.Now().UTC().Format(time.RFC3339),
+		}
+		if requested[adBreak.ID] {
+			record.RequestedSeconds = detected
+		}
+
+		if s, ok := stitchedByID[adBreak.ID]; ok {
+			for _, ad := range s.Ads {
+				record.FilledSeconds += adDuration(ad)
+				record.AdIDs = append(record.AdIDs, ad.AdID)
+			}
+			if detected > 0 && record.FilledSeconds > detected {
+				record.FilledSeconds = detected
+			}
+			if hasSlate && detected > record.FilledSeconds {
+				record.SlateSeconds = detected - record.FilledSeconds
+			}
+		}
+		if empty := detected - record.FilledSeconds - record.SlateSeconds; empty > 0 {
+			record.EmptySeconds = empty
+		}
+
+		seenFor := cueAvailSeenFor
+		if adBreak.Type == "static" {
+			seenFor = time.Duration(adBreak.Duration) * time.Second
+			if seenFor < minStaticAvailSeenFor {
+				seenFor = minStaticAvailSeenFor
+			}
+		}
+
+		h.avails.Record(ctx, record, breakKey(adBreak), v.key(), seenFor)
+	}
+}
+
+// key identifies a viewer for avail accounting: its session, or its IP and user agent
+func (v viewer) key() string {
+	if v.SessionID != "" {
+		return "session:" + v.SessionID
+	}
+	sum := sha256.Sum256([]byte(v.ClientIP + "|" + v.UserAgent))
+	return "client:" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/creative"
+	"github.com/gin-gonic/gin"
+)
+
+type CreativeHandler struct {
+	registry    *creative.Registry
+	conditioner *creative.Conditioner // nil when creative conditioning is disabled
+}
+
+func NewCreativeHandler(registry *creative.Registry, conditioner *creative.Conditioner) *CreativeHandler {
+	return &CreativeHandler{
+		registry:    registry,
+		conditioner: conditioner,
+	}
+}
+
+// List handles GET /admin/creatives
+func (h *CreativeHandler) List(c *gin.Context) {
+	entries, err := h.registry.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := c.Query("status")
+	filtered := make([]*creative.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if status == "" || entry.Status == status {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    filtered,
+		"total":   len(filtered),
+	})
+}
+
+// Purge handles DELETE /admin/creatives/:key
+func (h *CreativeHandler) Purge(c *gin.Context) {
+	key := c.Param("key")
+
+	// The conditioner also removes the conditioned output
+	var purged int
+	var err error
+	if h.conditioner != nil {
+		purged, err = h.conditioner.Purge(c.Request.Context(), key)
+	} else {
+		purged, err = h.registry.Purge(c.Request.Context(), key)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if purged == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Creative not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "purged": purged})
+}
+
+// Requeue handles POST /admin/creatives/:key/requeue
+func (h *CreativeHandler) Requeue(c *gin.Context) {
+	if h.conditioner == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Creative conditioning is disabled"})
+		return
+	}
+
+	key := c.Param("key")
+
+	queued, err := h.conditioner.Requeue(c.Request.Context(), key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if queued == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Creative not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "queued": queued})
+}
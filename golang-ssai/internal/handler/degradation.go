@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+	"github.com/gin-gonic/gin"
+)
+
+// DegradedHeader tells players and CDNs why a playlist wasn't (freshly) stitched
+const DegradedHeader = "X-SSAI-Degraded"
+
+// Degradation reasons
+const (
+	DegradedMasterPlaylist  = "master_playlist"  // no media playlist found in the master playlist
+	DegradedMediaPlaylist   = "media_playlist"   // media playlist fetch failed, master served
+	DegradedParse           = "parse"            // origin playlist couldn't be parsed
+	DegradedStitch          = "stitch"           // stitching failed
+	DegradedPanic           = "panic"            // the stitching pipeline panicked
+	DegradedOrigin          = "origin"           // origin failed, last good playlist served
+	DegradedChannelLookup   = "channel_lookup"   // channel lookup failed, last good playlist served
+	DegradedOriginUnhealthy = "origin_unhealthy" // no origin was healthy, an unhealthy one's playlist stitched
+)
+
+// maxLastGoodEntries bounds the last good playlists kept in memory (one per channel)
+const maxLastGoodEntries = 10000
+
+// lastGoodPlaylist is a stitched playlist kept to stand in for a failing origin
+type lastGoodPlaylist struct {
+	Manifest string `json:"manifest"`
+	Signed   bool   `json:"signed"` // the channel requires signed URLs
+}
+
+// degradationFor returns the degradation settings of a channel
+func (h *ManifestHandler) degradationFor(tenant, channel string) config.DegradationConfig {
+	return h.config.ChannelSettingsFor(tenant, channel).Degradation
+}
+
+// saveLastGood keeps a successfully stitched playlist (without viewer tokens) for the
+// channel's last_good_ttl
+func (h *ManifestHandler) saveLastGood(ctx context.Context, tenant, channel, manifest string, signed bool) {
+	ttl := h.degradationFor(tenant, channel).LastGoodTTL
+	if ttl <= 0 {
+		return
+	}
+
+	data, err := json.Marshal(lastGoodPlaylist{Manifest: manifest, Signed: signed})
+	if err != nil {
+		return
+	}
+	h.lastGood.Set(ctx, lastGoodKey(tenant, channel), string(data), ttl)
+}
+
+// loadLastGood returns the last good playlist of a channel, if it hasn't expired
+func (h *ManifestHandler) loadLastGood(ctx context.Context, tenant, channel string) (*lastGoodPlaylist, bool) {
+	raw, err := h.lastGood.Get(ctx, lastGoodKey(tenant, channel))
+	if err != nil {
+		return nil, false
+	}
+
+	var last lastGoodPlaylist
+	if err := json.Unmarshal([]byte(raw), &last); err != nil || last.Manifest == "" {
+		return nil, false
+	}
+	return &last, true
+}
+
+func lastGoodKey(tenant, channel string) string {
+	return tenant + "/" + channel
+}
+
+// serveDegraded serves manifest (the rewritten origin playlist or the last good one) in
+// place of a freshly stitched playlist, tagged with the reason. Channels with the fail
+// policy get a 502 instead.
+func (h *ManifestHandler) serveDegraded(c *gin.Context, tenant, channel, reason, manifest string, query url.Values) {
+	log := logging.FromContext(c.Request.Context())
+	if h.degradationFor(tenant, channel).Policy == config.DegradeFail {
+		log.Warn("Stitching failed and degradation is disabled for the channel", "reason", reason)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to build manifest", "reason": reason})
+		return
+	}
+
+	log.Warn("Serving degraded manifest", "reason", reason)
+	metrics.DegradedResponses.WithLabelValues(tenant, channel, reason).Inc()
+	c.Header(DegradedHeader, reason)
+	writePlaylist(c, hls.AppendQuery(h.rewriteSegmentURLs(c, tenant, manifest), query))
+}
+
+// serveLastGood serves the last good playlist of a channel when the origin (or Laravel)
+// failed; it reports false when there is none to serve
+func (h *ManifestHandler) serveLastGood(c *gin.Context, tenant, channel, reason string, query url.Values, verified bool) bool {
+	if h.degradationFor(tenant, channel).Policy == config.DegradeFail {
+		return false
+	}
+
+	last, ok := h.loadLastGood(c.Request.Context(), tenant, channel)
+	// A signed channel's playlist is only served to viewers whose token was checked
+	if !ok || (last.Signed && !verified) {
+		return false
+	}
+
+	h.serveDegraded(c, tenant, channel, reason, last.Manifest, query)
+	return true
+}
+
+// writePlaylist writes an HLS playlist response; live playlists are never cached
+func writePlaylist(c *gin.Context, manifest string) {
+	c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("Expires", "0")
+	// CORS headers for HLS players
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "Range")
+	c.Header("Access-Control-Expose-Headers", TrackingTokenHeader+", "+DegradedHeader)
+	c.String(http.StatusOK, manifest)
+}
@@ -1,28 +1,190 @@
 package handler
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/client"
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
 	"github.com/gin-gonic/gin"
 )
 
-type HealthHandler struct{}
+const defaultHealthTimeout = 2 * time.Second
 
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+// Dependency states
+const (
+	dependencyUp       = "up"
+	dependencyDown     = "down"
+	dependencyDisabled = "disabled"
+)
+
+type HealthHandler struct {
+	config        *config.Config
+	cache         cache.Cache
+	laravelClient *client.LaravelClient
+
+	mu         sync.Mutex
+	lastErrors map[string]dependencyError // kept across checks so a flapping dependency shows up
+}
+
+// DependencyStatus is the readiness of one dependency
+type DependencyStatus struct {
+	Status      string     `json:"status"`
+	LatencyMS   int64      `json:"latency_ms"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type dependencyError struct {
+	message string
+	at      time.Time
+}
+
+func NewHealthHandler(cfg *config.Config, c cache.Cache, laravelClient *client.LaravelClient) *HealthHandler {
+	return &HealthHandler{
+		config:        cfg,
+		cache:         c,
+		laravelClient: laravelClient,
+		lastErrors:    make(map[string]dependencyError),
+	}
 }
 
 // Health handles GET /health
 func (h *HealthHandler) Health(c *gin.Context) {
+	status := http.StatusOK
+	body := gin.H{
+		"status":  "healthy",
+		"service": "ssai-service",
+		"redis":   "disabled", // in-memory cache backend
+	}
+
+	if pinger, ok := h.cache.(cache.Pinger); ok {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second)
+		defer cancel()
+
+		if err := pinger.Ping(ctx); err != nil {
+			status = http.StatusServiceUnavailable
+			body["status"] = "unhealthy"
+			body["redis"] = "unreachable"
+			body["redis_error"] = err.Error()
+		} else {
+			body["redis"] = "ok"
+		}
+	}
+
+	c.JSON(status, body)
+}
+
+// Live handles GET /health/live: the process is up and serving requests
+func (h *HealthHandler) Live(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"status": "healthy",
+		"status":  "alive",
 		"service": "ssai-service",
 	})
 }
 
-// Metrics handles GET /metrics (Prometheus format)
-func (h *HealthHandler) Metrics(c *gin.Context) {
-	// TODO: Implement Prometheus metrics
-	c.String(http.StatusOK, "# Metrics endpoint\n")
+// Ready handles GET /health/ready: every dependency needed to stitch manifests is reachable
+func (h *HealthHandler) Ready(c *gin.Context) {
+	checks := map[string]func(ctx context.Context) error{
+		"laravel": h.laravelClient.Ping,
+	}
+	if pinger, ok := h.cache.(cache.Pinger); ok {
+		checks["redis"] = pinger.Ping
+	}
+	if h.config.Health.OriginURL != "" {
+		checks["origin"] = h.pingOrigin
+	}
+
+	timeout := h.config.Health.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	dependencies := make(map[string]DependencyStatus, len(checks)+1)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			status := h.runCheck(c.Request.Context(), name, check, timeout)
+			mu.Lock()
+			dependencies[name] = status
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if _, ok := checks["redis"]; !ok {
+		dependencies["redis"] = DependencyStatus{Status: dependencyDisabled} // in-memory cache backend
+	}
+
+	status, ready := http.StatusOK, "ready"
+	for _, dependency := range dependencies {
+		if dependency.Status == dependencyDown {
+			status, ready = http.StatusServiceUnavailable, "not_ready"
+		}
+	}
+
+	c.JSON(status, gin.H{
+		"status":       ready,
+		"service":      "ssai-service",
+		"dependencies": dependencies,
+	})
 }
 
+// runCheck runs one dependency check and records its last error
+func (h *HealthHandler) runCheck(ctx context.Context, name string, check func(ctx context.Context) error, timeout time.Duration) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	status := DependencyStatus{
+		Status:    dependencyUp,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err != nil {
+		status.Status = dependencyDown
+		h.lastErrors[name] = dependencyError{message: err.Error(), at: time.Now()}
+		logging.FromContext(ctx).Warn("Readiness check failed", "check", name, "error", err)
+	}
+	if lastErr, ok := h.lastErrors[name]; ok {
+		at := lastErr.at
+		status.LastError = lastErr.message
+		status.LastErrorAt = &at
+	}
+
+	return status
+}
+
+// pingOrigin fetches the sample origin playlist
+func (h *HealthHandler) pingOrigin(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.config.Health.OriginURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "FAST-Ads-SSAI/1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch origin: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from origin", resp.StatusCode)
+	}
+	return nil
+}
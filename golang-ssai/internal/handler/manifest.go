@@ -2,48 +2,90 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/fast-ads-backend/golang-ssai/internal/cache"
 	"github.com/fast-ads-backend/golang-ssai/internal/client"
 	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/creative"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
 	"github.com/fast-ads-backend/golang-ssai/internal/models"
 	"github.com/fast-ads-backend/golang-ssai/internal/parser"
 	"github.com/fast-ads-backend/golang-ssai/internal/service"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+	"github.com/fast-ads-backend/golang-ssai/pkg/urlrewrite"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ManifestHandler struct {
 	config          *config.Config
-	cache           *cache.RedisCache
+	cache           cache.Cache
 	laravelClient   *client.LaravelClient
 	parser          *parser.M3U8Parser
 	adBreakDetector *service.AdBreakDetector
 	vastParser      *parser.VASTParser
+	conditioner     *creative.Conditioner // nil when creative conditioning is disabled
+	adManifests     *cache.ContentCache   // ad and slate media playlists (immutable VOD)
+	podFitter       *service.PodFitter
+	decisions       *service.AdDecisionService
+	origin          *service.OriginFetcher
+	originHealth    *service.OriginHealth
+	splicer         *service.OriginSplicer
+	httpClient      *http.Client // origin, ad and slate playlists
+	lastGood        *cache.MemoryCache // last good stitched playlist per channel
+	avails          *service.AvailRecorder // nil when avail accounting is disabled
+	playlistMonitor *service.PlaylistMonitor // nil when playlist health checks are disabled
+	tenantLimit     gin.HandlerFunc          // nil when tenants aren't rate limited
 }
 
-func NewManifestHandler(cfg *config.Config) *ManifestHandler {
-	redisCache := cache.NewRedisCache(cfg)
-	laravelClient := client.NewLaravelClient(cfg)
+// NewManifestHandler creates the manifest handler; conditioner, avails and playlistMonitor may be nil
+func NewManifestHandler(cfg *config.Config, sharedCache cache.Cache, laravelClient *client.LaravelClient, conditioner *creative.Conditioner, avails *service.AvailRecorder, playlistMonitor *service.PlaylistMonitor) *ManifestHandler {
 	m3u8Parser := parser.NewM3U8Parser()
 	adBreakDetector := service.NewAdBreakDetector()
-	vastParser := parser.NewVASTParser()
+	vastParser := parser.NewVASTParser(cache.NewContentCache(sharedCache, "vast"), cfg.Cache.VASTTTL)
 
 	return &ManifestHandler{
 		config:          cfg,
-		cache:           redisCache,
+		cache:           sharedCache,
 		laravelClient:   laravelClient,
 		parser:          m3u8Parser,
 		adBreakDetector: adBreakDetector,
 		vastParser:      vastParser,
+		conditioner:     conditioner,
+		adManifests:     cache.NewContentCache(sharedCache, "ad_manifest"),
+		podFitter:       service.NewPodFitter(cfg.Stitching.PodTolerance.Seconds()),
+		decisions: service.NewAdDecisionService(laravelClient, sharedCache, cfg.Cache.AdDecisionTTL,
+			cfg.Cache.AdDecisionPrefetchAhead, cfg.Cache.PrefetchWorkers),
+		origin:          service.NewOriginFetcher(sharedCache, cfg.Cache.ManifestTTL),
+		originHealth:    service.NewOriginHealth(cfg.OriginFailover, sharedCache),
+		splicer:         service.NewOriginSplicer(sharedCache),
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: metrics.InstrumentTransport("origin", tracing.Transport(nil)),
+		},
+		avails:          avails,
+		playlistMonitor: playlistMonitor,
+		lastGood:        cache.NewMemoryCache(maxLastGoodEntries),
 	}
 }
 
+// LimitTenants rate limits manifest requests per tenant once their channel is resolved
+// (see ManifestTenantRateLimit)
+func (h *ManifestHandler) LimitTenants(limit gin.HandlerFunc) {
+	h.tenantLimit = limit
+}
+
 // GetManifest handles GET /fast/{tenant}/{channel}.m3u8
 func (h *ManifestHandler) GetManifest(c *gin.Context) {
 	tenant := c.Param("tenant")
@@ -54,8 +96,38 @@ func (h *ManifestHandler) GetManifest(c *gin.Context) {
 		channel = channel[:len(channel)-5]
 	}
 
+	// Every log line of the request carries its tenant, channel and session
+	ctx := logging.With(c.Request.Context(), logging.KeyTenant, tenant, logging.KeyChannel, channel)
+	if sessionID := c.Query("session_id"); sessionID != "" {
+		ctx = logging.With(ctx, logging.KeySessionID, sessionID)
+	}
+	ctx = logging.SampleDebug(ctx, tenant)
+	// Origin, ad and VAST URLs are rewritten by the tenant's host rewrite rules
+	ctx = urlrewrite.WithRules(ctx, h.config.HostRewritesFor(tenant))
+	c.Request = c.Request.WithContext(ctx)
+	log := logging.FromContext(ctx)
+
+	// Unknown channels are labeled "unknown" so arbitrary URLs can't blow up metric cardinality
+	start := time.Now()
+	metricTenant, metricChannel := "unknown", "unknown"
+	defer func() {
+		metrics.ManifestRequests.WithLabelValues(metricTenant, metricChannel, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.ManifestDuration.WithLabelValues(metricTenant, metricChannel).Observe(time.Since(start).Seconds())
+	}()
+
 	// Get channel info first to check cache with channel config hash
-	channelInfo, err := h.laravelClient.GetChannelBySlug(c.Request.Context(), tenant, channel)
+	channelInfo, err := h.laravelClient.GetChannelBySlug(ctx, tenant, channel)
+	if err != nil && h.serveLastGood(c, tenant, channel, DegradedChannelLookup, nil, false) {
+		log.Error("Channel lookup failed, served last good playlist", "error", err)
+		return
+	}
+	if errors.Is(err, client.ErrUnavailable) {
+		// Laravel is down and the channel isn't cached: players should retry shortly
+		log.Error("Laravel unavailable and no cached channel information", "error", err)
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Channel information temporarily unavailable"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to get channel information",
@@ -64,93 +136,127 @@ func (h *ManifestHandler) GetManifest(c *gin.Context) {
 		return
 	}
 
+	metricTenant, metricChannel = tenant, channel
+
+	// Tenant rate limits only count requests for channels that exist
+	if h.tenantLimit != nil {
+		c.Set(resolvedTenantKey, strconv.Itoa(channelInfo.TenantID))
+		if h.tenantLimit(c); c.IsAborted() {
+			return
+		}
+	}
+
+	// Channels that require signed URLs reject requests without a valid token; the
+	// token is carried over to every segment of the returned playlist
+	playbackQuery, ok := verifyPlaybackToken(c, h.config, channelInfo)
+	if !ok {
+		return
+	}
+
+	// Players authenticate their tracking events with a token bound to this session
+	if h.config.Tracking.TokenSecret != "" {
+		c.Header(TrackingTokenHeader, mintTrackingToken(h.config.Tracking, trackingPrincipal{
+			TenantID:  channelInfo.TenantID,
+			ChannelID: channelInfo.ID,
+			SessionID: c.Query("session_id"),
+		}, time.Now()))
+	}
+
+	inFlight := metrics.ManifestsInFlight.WithLabelValues(tenant, channel)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
 	// Store tenantID from channelInfo to ensure correct tenant is used
 	tenantID := channelInfo.TenantID
-	fmt.Printf("DEBUG: GetManifest - tenant slug: %s, channel: %s, tenantID from channel: %d, channelID: %d\n", tenant, channel, tenantID, channelInfo.ID)
+	log.Debug("Channel resolved", "tenant_id", tenantID, "channel_id", channelInfo.ID)
 
-	// For live streams, disable caching to ensure always fresh segments
-	// Live stream segments expire quickly, so we need to fetch fresh manifest every time
-	// Only use cache for ad decision, not for manifest itself
-	// Skip cache check for live streams - always fetch fresh manifest
-	// This ensures segments are always current
+	// Stitched manifests are never cached (they're per viewer), but origin playlists are
+	// shared by all viewers of a channel for a fraction of a target duration
 
-	// Get original manifest URL
-	originURL := channelInfo.HLSManifestURL
-	if originURL == "" {
-		// Fallback to default origin
-		originURL = h.getOriginURL(tenant, channel)
-	}
+	// Fetch from the first healthy origin, failing over down the channel's origin list
+	origins := h.channelOrigins(tenant, channel, channelInfo)
+	splice := h.splicer.Load(ctx, tenant+"/"+channel)
 
-	originalManifest, err := h.fetchOriginalManifest(originURL)
+	playlist, err := h.fetchOrigin(ctx, tenant, channel, origins, splice)
+	if err != nil && h.serveLastGood(c, tenant, channel, DegradedOrigin, playbackQuery, true) {
+		log.Error("Origin fetch failed, served last good playlist", "origin_url", origins[0], "error", err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":      "Failed to fetch original manifest",
 			"details":    err.Error(),
-			"origin_url": originURL,
+			"origin_url": origins[0],
 		})
 		return
 	}
+	originURL := playlist.URL
+	if playlist.Unhealthy {
+		// Still stitched, but tagged so the stale or faulty origin shows in responses and metrics
+		log.Warn("No healthy origin, serving the first available playlist", "origin_url", originURL)
+		metrics.DegradedResponses.WithLabelValues(tenant, channel, DegradedOriginUnhealthy).Inc()
+		c.Header(DegradedHeader, DegradedOriginUnhealthy)
+	}
 
 	// Rewrite URLs in original manifest first (before parsing)
-	rewrittenOriginal := h.rewriteManifestURLs(originalManifest, originURL, c)
+	rewrittenOriginal := h.rewriteManifestURLs(ctx, playlist.Playlist, originURL)
+
+	// From here on any failure serves the rewritten origin playlist rather than an error
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Panic while stitching", "panic", r, "stack", string(debug.Stack()))
+			if !c.Writer.Written() {
+				h.serveDegraded(c, tenant, channel, DegradedPanic, rewrittenOriginal, playbackQuery)
+			}
+		}
+	}()
 
 	// Check if this is a master playlist (contains #EXT-X-STREAM-INF)
 	isMasterPlaylist := strings.Contains(rewrittenOriginal, "#EXT-X-STREAM-INF")
 
-	// If master playlist, fetch the first media playlist
+	// Variants describe the channel's encoding ladder (used to condition MP4 creatives)
+	var variants []hls.Variant
+
+	// If master playlist, stitch its first media playlist
 	if isMasterPlaylist {
-		fmt.Printf("DEBUG: Detected master playlist, fetching first media playlist...\n")
-		mediaPlaylistURL, err := h.extractFirstMediaPlaylistURL(rewrittenOriginal, originURL)
-		if err != nil {
-			fmt.Printf("ERROR: Failed to extract media playlist URL: %v\n", err)
-			// Fallback: return rewritten original manifest
-			c.Header("Content-Type", "application/vnd.apple.mpegurl")
-			c.Header("Cache-Control", "public, max-age=10")
-			c.String(http.StatusOK, rewrittenOriginal)
+		variants = hls.ParseVariants(rewrittenOriginal)
+
+		if playlist.MediaURL == "" {
+			h.serveDegraded(c, tenant, channel, DegradedMasterPlaylist, rewrittenOriginal, playbackQuery)
 			return
 		}
-
-		fmt.Printf("DEBUG: Fetching media playlist from: %s\n", mediaPlaylistURL)
-		mediaManifest, err := h.fetchOriginalManifest(mediaPlaylistURL)
-		if err != nil {
-			fmt.Printf("ERROR: Failed to fetch media playlist: %v\n", err)
-			// Fallback: return rewritten original manifest
-			c.Header("Content-Type", "application/vnd.apple.mpegurl")
-			c.Header("Cache-Control", "public, max-age=10")
-			c.String(http.StatusOK, rewrittenOriginal)
+		if playlist.Media == "" {
+			h.serveDegraded(c, tenant, channel, DegradedMediaPlaylist, rewrittenOriginal, playbackQuery)
 			return
 		}
 
 		// Use media playlist instead
-		rewrittenOriginal = h.rewriteManifestURLs(mediaManifest, mediaPlaylistURL, c)
-		fmt.Printf("DEBUG: Using media playlist (length: %d bytes)\n", len(rewrittenOriginal))
+		rewrittenOriginal = h.rewriteManifestURLs(ctx, playlist.Media, playlist.MediaURL)
 	}
 
+	// Keep numbering continuous across origin switches
+	rewrittenOriginal = h.spliceOrigin(ctx, tenant, channel, splice, originURL, rewrittenOriginal)
+
 	// Parse manifest
 	manifest, err := h.parser.Parse(rewrittenOriginal)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to parse manifest: %v\n", err)
-		fmt.Printf("DEBUG: Manifest preview (first 500 chars):\n%s\n", rewrittenOriginal[:min(500, len(rewrittenOriginal))])
-		// Fallback: return rewritten original manifest
-		c.Header("Content-Type", "application/vnd.apple.mpegurl")
-		c.Header("Cache-Control", "public, max-age=10")
-		c.String(http.StatusOK, rewrittenOriginal)
+		log.Error("Failed to parse manifest", "bytes", len(rewrittenOriginal), "error", err)
+		h.serveDegraded(c, tenant, channel, DegradedParse, rewrittenOriginal, playbackQuery)
 		return
 	}
 
-	// Calculate total duration for debug
-	var totalDuration float64
-	for _, seg := range manifest.Segments {
-		totalDuration += seg.Duration
-	}
-	fmt.Printf("DEBUG: Parsed manifest - segments: %d, total duration: %.2f seconds\n", len(manifest.Segments), totalDuration)
+	// Encoding profile MP4-only creatives are conditioned into for this channel
+	creativeProfile := creative.ProfileFromVariants(variants, manifest.TargetDuration, h.config.Creatives)
 
 	// Get channel info (already fetched earlier) contains ad_break_interval_seconds
 	// Generate static rules from channel config
-	staticRules := h.generateStaticRulesFromChannel(channelInfo)
+	staticRules := h.generateStaticRulesFromChannel(ctx, channelInfo)
+
+	// Slate used to pad underfilled breaks (and fill empty ones, depending on policy)
+	slate := h.slateFor(tenant, channel, channelInfo)
 
 	// tenantID already set from channelInfo above
-	channelConfig, err := h.laravelClient.GetChannelConfig(c.Request.Context(), tenantID, channel)
+	channelConfig, err := h.laravelClient.GetChannelConfig(ctx, tenantID, channel)
 	if err == nil && len(channelConfig.AdRules) > 0 {
 		// Add additional rules from channel config
 		for _, rule := range channelConfig.AdRules {
@@ -164,171 +270,227 @@ func (h *ManifestHandler) GetManifest(c *gin.Context) {
 	}
 
 	// Detect ad breaks (SCTE-35 + static rules)
-	adBreaks := h.adBreakDetector.DetectAdBreaks(manifest, originalManifest, staticRules)
-	fmt.Printf("DEBUG: Detected %d ad breaks for channel %s\n", len(adBreaks), channel)
-
-	// Collect all ad breaks with their ads for batch stitching
-	adBreaksWithAds := make([]parser.AdBreakWithAds, 0, len(adBreaks))
+	// Cue spans are segment indexes, so detect on the same media playlist the stitcher uses
+	adBreaks := h.adBreakDetector.DetectAdBreaks(ctx, manifest, rewrittenOriginal, staticRules)
+	log.Debug("Ad breaks detected", "segments", len(manifest.Segments), "ad_breaks", len(adBreaks))
 	for _, adBreak := range adBreaks {
-		fmt.Printf("DEBUG: Getting ads for break: %s (position: %s, offset: %.2f)\n", adBreak.ID, adBreak.Position, adBreak.Offset)
-		ads, err := h.getAdsForBreak(tenant, channel, adBreak, c)
-		if err != nil {
-			fmt.Printf("ERROR: Failed to get ads for break %s: %v\n", adBreak.ID, err)
-			continue // Skip this break if error
-		}
-		if len(ads) == 0 {
-			fmt.Printf("WARN: No ads returned for break %s (position: %s, offset: %.2f)\n", adBreak.ID, adBreak.Position, adBreak.Offset)
-			continue // Skip this break if no ads
-		}
-
-		fmt.Printf("DEBUG: Got %d ads for break %s\n", len(ads), adBreak.ID)
-		adBreaksWithAds = append(adBreaksWithAds, parser.AdBreakWithAds{
-			Offset: adBreak.Offset,
-			Ads:    ads,
-		})
-
-		// Emit tracking events for impressions (async)
-		// Use tenantID from channelInfo to ensure correct tenant
-		fmt.Printf("DEBUG: Emitting tracking events - tenantID: %d, channel: %s, ads count: %d\n", tenantID, channel, len(ads))
-		go h.emitTrackingEvents(tenantID, channelInfo.ID, channel, ads, c)
+		metrics.AdBreaksDetected.WithLabelValues(tenant, channel, adBreak.Type).Inc()
+	}
+
+	// Resolve decisions, VAST and ad manifests concurrently under one deadline so a slow
+	// ad server or VAST endpoint can't hold up the playlist; late ads are dropped (or slated)
+	viewer := newViewer(c)
+	upcoming := h.adBreakDetector.UpcomingStaticBreaks(manifest, staticRules, adBreaks, h.config.Cache.StaticPrefetchAhead)
+	h.prefetchDecisions(ctx, tenant, channel, tenantID, upcoming, viewer)
+	stitchCtx, cancel := context.WithTimeout(ctx, h.stitchDeadline())
+	defer cancel()
+
+	// Fetch the slate once, alongside ad resolution; it pads every underfilled break
+	// (including pods that lost ads to the deadline)
+	slateCh := make(chan string, 1)
+	if slate.URL != "" && len(adBreaks) > 0 {
+		go func() {
+			slateManifest, err := h.fetchAdManifest(stitchCtx, slate.URL)
+			if err != nil {
+				log.Error("Failed to fetch slate", "url", slate.URL, "error", err)
+				slateCh <- ""
+				return
+			}
+			slateCh <- h.rewriteManifestURLs(stitchCtx, slateManifest, slate.URL)
+		}()
+	} else {
+		slateCh <- ""
 	}
 
-	fmt.Printf("DEBUG: Total ad breaks with ads: %d\n", len(adBreaksWithAds))
+	adBreaksWithAds, requested := h.resolveDecisions(stitchCtx, tenant, channel, tenantID, adBreaks, slate, viewer)
 
 	// Process VAST URLs to extract HLS manifests and fetch ad segments before stitching
-	processedAdBreaks := make([]parser.AdBreakWithAds, 0, len(adBreaksWithAds))
-	for _, adBreak := range adBreaksWithAds {
-		processedAds := make([]models.Ad, 0, len(adBreak.Ads))
-		for _, ad := range adBreak.Ads {
-			// If VAST URL doesn't end with .m3u8, fetch VAST and extract HLS manifest
-			if !strings.HasSuffix(strings.ToLower(ad.VASTURL), ".m3u8") {
-				fmt.Printf("INFO: Processing VAST URL for ad %d: %s\n", ad.AdID, ad.VASTURL)
-				vastInfo, err := h.vastParser.ProcessVAST(ad.VASTURL)
-				if err != nil {
-					fmt.Printf("ERROR: Failed to process VAST for ad %d: %v\n", ad.AdID, err)
-					// Skip this ad if VAST processing fails
-					continue
-				}
+	resolvedAdBreaks := h.resolveAds(stitchCtx, tenant, channel, adBreaksWithAds, creativeProfile)
+	slateManifest := <-slateCh
 
-				// Extract HLS manifest URL from VAST
-				if vastInfo.HLSManifestURL != "" {
-					hlsURL := vastInfo.HLSManifestURL
-					// Rewrite localhost:8000 to ads.wkkworld.com
-					if strings.Contains(hlsURL, "localhost:8000") {
-						hlsURL = strings.ReplaceAll(hlsURL, "http://localhost:8000", "https://ads.wkkworld.com")
-						fmt.Printf("INFO: Rewrote localhost:8000 to ads.wkkworld.com in HLS URL for ad %d\n", ad.AdID)
-					}
-					fmt.Printf("INFO: Extracted HLS manifest from VAST for ad %d: %s\n", ad.AdID, hlsURL)
+	processedAdBreaks := make([]parser.AdBreakWithAds, 0, len(resolvedAdBreaks))
+	for i, adBreak := range resolvedAdBreaks {
+		// Drop ads that would overrun the signaled avail
+		processedAds := h.fitPod(ctx, adBreak.ID, adBreak.Ads, adBreak.Duration)
 
-					// Fetch ad manifest and rewrite relative URLs to absolute
-					adManifest, err := h.fetchOriginalManifest(hlsURL)
-					if err != nil {
-						fmt.Printf("ERROR: Failed to fetch ad manifest for ad %d: %v\n", ad.AdID, err)
-						continue
-					}
+		metrics.AdsDropped.WithLabelValues(tenant, channel, metrics.DropUnresolved).Add(float64(len(adBreaksWithAds[i].Ads) - len(adBreak.Ads)))
+		metrics.AdsDropped.WithLabelValues(tenant, channel, metrics.DropPodFit).Add(float64(len(adBreak.Ads) - len(processedAds)))
+		metrics.AdsStitched.WithLabelValues(tenant, channel).Add(float64(len(processedAds)))
 
-					// Rewrite relative URLs in ad manifest to absolute
-					adManifestBase := hlsURL
-					if lastSlash := strings.LastIndex(adManifestBase, "/"); lastSlash >= 0 {
-						adManifestBase = adManifestBase[:lastSlash+1]
-					}
-					adManifest = h.rewriteManifestURLs(adManifest, hlsURL, c)
-
-					// For ExoPlayer compatibility: convert ad URLs to match origin scheme
-					// If origin is HTTP, convert ad HTTPS URLs to HTTP (if possible)
-					// This prevents mixed content issues in ExoPlayer
-					if strings.HasPrefix(originURL, "http://") {
-						// Origin is HTTP, try to convert ad HTTPS URLs to HTTP
-						adManifest = strings.ReplaceAll(adManifest, "https://ads.wkkworld.com", "http://ads.wkkworld.com")
-						fmt.Printf("INFO: Converted ad URLs to HTTP for ExoPlayer compatibility (origin is HTTP)\n")
-					}
-
-					// Store rewritten manifest content in VASTURL (temporary, will be used by stitcher)
-					// The original HLS URL is no longer needed since we have the manifest content
-					ad.VASTURL = adManifest
-				} else if vastInfo.MP4URL != "" {
-					// Fallback to MP4 if no HLS
-					fmt.Printf("WARN: Ad %d has MP4 URL but no HLS manifest. MP4: %s\n", ad.AdID, vastInfo.MP4URL)
-					// For now, skip MP4 ads (we need HLS for SSAI)
-					continue
-				} else {
-					fmt.Printf("ERROR: No video URL found in VAST for ad %d\n", ad.AdID)
-					continue
-				}
-			} else {
-				// Already an HLS manifest URL - fetch and rewrite
-				fmt.Printf("INFO: Ad %d already has HLS manifest URL: %s\n", ad.AdID, ad.VASTURL)
-				adManifest, err := h.fetchOriginalManifest(ad.VASTURL)
-				if err != nil {
-					fmt.Printf("ERROR: Failed to fetch ad manifest for ad %d: %v\n", ad.AdID, err)
-					continue
-				}
-				adManifest = h.rewriteManifestURLs(adManifest, ad.VASTURL, c)
-				// Store rewritten manifest content in VASTURL
-				ad.VASTURL = adManifest
-			}
-			processedAds = append(processedAds, ad)
+		// Emit tracking events for impressions (async), only for ads that are actually stitched
+		// Use tenantID from channelInfo to ensure correct tenant
+		if len(processedAds) > 0 {
+			go h.emitTrackingEvents(context.WithoutCancel(ctx), tenantID, channelInfo.ID, processedAds, viewer)
 		}
 
-		if len(processedAds) > 0 {
-			processedAdBreaks = append(processedAdBreaks, parser.AdBreakWithAds{
-				Offset: adBreak.Offset,
-				Ads:    processedAds,
-			})
+		if len(processedAds) > 0 || slateManifest != "" {
+			adBreak.Ads = processedAds
+			adBreak.Slate = slateManifest
+			processedAdBreaks = append(processedAdBreaks, adBreak)
 		}
 	}
 
+	if h.avails != nil {
+		go h.recordAvails(context.WithoutCancel(ctx), tenant, channel, channelInfo, adBreaks, requested, processedAdBreaks, slateManifest != "", viewer)
+	}
+
 	// Stitch all ad breaks at once (more efficient)
 	stitchedManifest := rewrittenOriginal
 	if len(processedAdBreaks) > 0 {
 		var stitchErr error
-		stitchedManifest, stitchErr = h.parser.StitchMultipleAdBreaks(rewrittenOriginal, processedAdBreaks)
+		spanCtx, span := tracing.Start(ctx, "stitch", attribute.Int("ad_breaks", len(processedAdBreaks)))
+		stitchedManifest, stitchErr = h.parser.StitchMultipleAdBreaks(spanCtx, rewrittenOriginal, processedAdBreaks)
+		tracing.End(span, stitchErr)
 		if stitchErr != nil {
-			fmt.Printf("ERROR: Failed to stitch ad breaks: %v\n", stitchErr)
-			// Log error but return rewritten original manifest
-			stitchedManifest = rewrittenOriginal
+			log.Error("Failed to stitch ad breaks", "error", stitchErr)
+			h.serveDegraded(c, tenant, channel, DegradedStitch, rewrittenOriginal, playbackQuery)
+			return
 		}
 	}
 
-	// URLs should already be rewritten, but rewrite again to be safe
-	rewrittenManifest := h.rewriteManifestURLs(stitchedManifest, originURL, c)
+	// URLs should already be absolute, but make sure (host rewrite rules were applied
+	// when each playlist was fetched and must not be applied twice)
+	rewrittenManifest := h.absoluteManifestURLs(ctx, stitchedManifest, originURL)
 
 	// Don't cache manifest for live streams - always return fresh
 	// This ensures segments are always current and not expired
 	// Cache is only used for ad decisions, not for manifest content
 
+	// Kept (without viewer tokens) to stand in for the origin if it fails
+	h.saveLastGood(ctx, tenant, channel, rewrittenManifest, channelInfo.RequireSignedURLs)
+
 	// Return stitched manifest
-	c.Header("Content-Type", "application/vnd.apple.mpegurl")
-	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
-	c.Header("Pragma", "no-cache")
-	c.Header("Expires", "0")
-	// CORS headers for HLS players
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "Range")
-	c.String(http.StatusOK, rewrittenManifest)
+	writePlaylist(c, hls.AppendQuery(h.rewriteSegmentURLs(c, tenant, rewrittenManifest), playbackQuery))
 }
 
-func (h *ManifestHandler) getOriginURL(tenant, channel string) string {
-	// Fallback: construct URL from tenant and channel
-	// This should ideally come from channel config
-	return fmt.Sprintf("https://cdn.example.com/hls/%s/%s.m3u8", tenant, channel)
+// resolveMP4Creative returns the HLS manifest to stitch for an MP4-only creative.
+// Unknown creatives are queued for conditioning and the fallback slate is used until ready.
+func (h *ManifestHandler) resolveMP4Creative(ctx context.Context, vastInfo *parser.VASTInfo, profile creative.Profile) string {
+	log := logging.FromContext(ctx)
+	if h.conditioner == nil {
+		log.Warn("Ad has an MP4 but no HLS manifest and conditioning is disabled", "mp4_url", vastInfo.MP4URL)
+		return ""
+	}
+
+	// Fast path: creative already conditioned for this channel's profile
+	if entry, err := vastInfo.LookupCreative(ctx, h.conditioner.Registry(), profile); err == nil && entry != nil && entry.Status == creative.StatusReady {
+		log.Debug("Using conditioned HLS creative", "creative", entry.Key, "url", entry.ManifestURL)
+		return entry.ManifestURL
+	}
+
+	// Unknown (or not ready) creative - registers and queues it if needed
+	if manifestURL, ready := h.conditioner.Resolve(ctx, vastInfo.CreativeKey(), vastInfo.UniversalAdID, vastInfo.MP4URL, profile); ready {
+		log.Debug("Using conditioned HLS creative", "url", manifestURL)
+		return manifestURL
+	}
+
+	slateURL := h.conditioner.SlateURL()
+	if slateURL == "" {
+		log.Warn("Ad is still conditioning and no slate is configured, skipping")
+		return ""
+	}
+
+	log.Info("Ad is still conditioning, using slate", "slate_url", slateURL)
+	return slateURL
+}
+
+// newAdBreakWithAds prepares a detected break for stitching.
+// Cue-driven breaks replace the origin's avail; static breaks, and cue breaks whose
+// avail span is unknown, are inserted.
+func (h *ManifestHandler) newAdBreakWithAds(adBreak models.AdBreak, ads []models.Ad) parser.AdBreakWithAds {
+	return parser.AdBreakWithAds{
+		ID:         adBreak.ID,
+		Offset:     adBreak.Offset,
+		Duration:   float64(adBreak.Duration),
+		Ads:        ads,
+		Replace:    adBreak.Type == "scte35" && !adBreak.SpanUnknown,
+		StartIndex: adBreak.StartIndex,
+		EndIndex:   adBreak.EndIndex,
+		Elapsed:    adBreak.Elapsed,
+	}
+}
+
+// fitPod keeps the ads that fit the break, using the actual duration of each ad's
+// manifest (ad.VASTURL holds the manifest content once processed)
+func (h *ManifestHandler) fitPod(ctx context.Context, breakID string, ads []models.Ad, breakDuration float64) []models.Ad {
+	if len(ads) == 0 || breakDuration <= 0 {
+		return ads
+	}
+
+	durations := make([]float64, len(ads))
+	for i, ad := range ads {
+		durations[i] = adDuration(ad)
+	}
+
+	indexes := h.podFitter.Fit(durations, breakDuration)
+	if len(indexes) == len(ads) {
+		return ads
+	}
+	logging.FromContext(ctx).Debug("Pod overruns the break, dropping ads", logging.KeyBreakID, breakID,
+		"kept", len(indexes), "ads", len(ads), "break_duration", breakDuration)
+
+	fitted := make([]models.Ad, 0, len(indexes))
+	for _, i := range indexes {
+		fitted = append(fitted, ads[i])
+	}
+	return fitted
 }
 
-func (h *ManifestHandler) fetchOriginalManifest(originURL string) (string, error) {
-	// Fetch manifest from origin
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// adDuration returns the actual duration of a processed ad (from its manifest when it parses)
+func adDuration(ad models.Ad) float64 {
+	adManifest, err := hls.ParseManifest(ad.VASTURL)
+	if err != nil || len(adManifest.Segments) == 0 {
+		return float64(ad.DurationSeconds)
 	}
 
-	req, err := http.NewRequest("GET", originURL, nil)
+	var duration float64
+	for _, seg := range adManifest.Segments {
+		duration += seg.Duration
+	}
+	return duration
+}
+
+// slateFor returns the slate settings of a channel; values sent by Laravel win over config
+func (h *ManifestHandler) slateFor(tenant, channel string, channelInfo *models.ChannelInfo) config.SlateConfig {
+	slate := h.config.ChannelSettingsFor(tenant, channel).Slate
+
+	if channelInfo.SlateURL != "" {
+		slate.URL = channelInfo.SlateURL
+	}
+	if channelInfo.EmptyBreakPolicy != "" {
+		slate.EmptyBreakPolicy = channelInfo.EmptyBreakPolicy
+	}
+
+	return slate
+}
+
+// fetchOriginManifest fetches a channel playlist from the origin. Viewers of the same
+// channel share one in-flight fetch and a copy cached for part of a target duration.
+func (h *ManifestHandler) fetchOriginManifest(ctx context.Context, tenant, channel, originURL string) (string, error) {
+	originURL = urlrewrite.FromContext(ctx).Apply(originURL)
+	ctx, span := tracing.Start(ctx, "origin.fetch", attribute.String("origin.url", originURL))
+	start := time.Now()
+	manifest, err := h.origin.Fetch(ctx, originURL, func(ctx context.Context) (string, error) {
+		return h.fetchOriginalManifest(ctx, originURL)
+	})
+	tracing.End(span, err)
+
+	metrics.OriginFetchDuration.WithLabelValues(tenant, channel).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.OriginFetchErrors.WithLabelValues(tenant, channel).Inc()
+	}
+	return manifest, err
+}
+
+func (h *ManifestHandler) fetchOriginalManifest(ctx context.Context, originURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", originURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", "FAST-Ads-SSAI/1.0")
 
-	resp, err := client.Do(req)
+	resp, err := h.httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch manifest: %w", err)
 	}
@@ -346,117 +508,158 @@ func (h *ManifestHandler) fetchOriginalManifest(originURL string) (string, error
 	return string(body), nil
 }
 
-func (h *ManifestHandler) getAdsForBreak(tenant, channel string, adBreak models.AdBreak, c *gin.Context) ([]models.Ad, error) {
-	// Get channel info to get tenant ID
-	channelInfo, err := h.laravelClient.GetChannelBySlug(c.Request.Context(), tenant, channel)
+// fetchAdManifest fetches an ad (or slate) media playlist. Complete VOD playlists never
+// change, so they are cached for VASTTTL, keyed by URL without cache busters.
+func (h *ManifestHandler) fetchAdManifest(ctx context.Context, manifestURL string) (string, error) {
+	manifestURL = urlrewrite.FromContext(ctx).Apply(manifestURL)
+	ctx, span := tracing.Start(ctx, "ad_manifest.fetch", attribute.String("ad_manifest.url", manifestURL))
+	manifest, err := h.fetchCachedAdManifest(ctx, manifestURL)
+	tracing.End(span, err)
+	return manifest, err
+}
+
+func (h *ManifestHandler) fetchCachedAdManifest(ctx context.Context, manifestURL string) (string, error) {
+	if h.config.Cache.VASTTTL <= 0 {
+		return h.fetchOriginalManifest(ctx, manifestURL)
+	}
+
+	return h.adManifests.Get(ctx, manifestURL, func(ctx context.Context) (string, time.Duration, error) {
+		manifest, err := h.fetchOriginalManifest(ctx, manifestURL)
+		if err != nil {
+			return "", 0, err
+		}
+		if !strings.Contains(manifest, "#EXT-X-ENDLIST") {
+			return manifest, 0, nil // not VOD, may still change
+		}
+		return manifest, h.config.Cache.VASTTTL, nil
+	})
+}
+
+func (h *ManifestHandler) getAdsForBreak(ctx context.Context, tenant, channel string, tenantID int, adBreak models.AdBreak, v viewer) ([]models.Ad, error) {
+	ctx, span := tracing.Start(ctx, "ad_decision",
+		attribute.String("ad_break.id", adBreak.ID), attribute.String("ad_break.type", adBreak.Type))
+	ads, err := h.decideAdsForBreak(ctx, tenant, channel, tenantID, adBreak, v)
+	span.SetAttributes(attribute.Int("ads", len(ads)))
+	tracing.End(span, err)
+	return ads, err
+}
+
+func (h *ManifestHandler) decideAdsForBreak(ctx context.Context, tenant, channel string, tenantID int, adBreak models.AdBreak, v viewer) ([]models.Ad, error) {
+	log := logging.FromContext(ctx).With(logging.KeyBreakID, adBreak.ID)
+
+	req, cacheKey := h.decisionRequest(tenant, channel, tenantID, adBreak, v)
+	log.Debug("Requesting ad decision", "position", req.Position, "duration", req.DurationSeconds, "key", cacheKey)
+
+	// Cached per break and audience; concurrent viewers share one Laravel call
+	start := time.Now()
+	resp, err := h.decisions.GetDecision(ctx, cacheKey, req)
+	metrics.AdDecisionDuration.WithLabelValues(tenant, channel).Observe(time.Since(start).Seconds())
 	if err != nil {
-		fmt.Printf("ERROR: Failed to get channel info for %s/%s: %v\n", tenant, channel, err)
-		return nil, fmt.Errorf("failed to get channel info: %w", err)
+		metrics.AdDecisions.WithLabelValues(tenant, channel, "error").Inc()
+		log.Error("Ad decision request failed", "error", err)
+		return nil, err
+	}
+
+	if !resp.Success {
+		log.Warn("Ad decision returned success=false")
+		metrics.AdDecisions.WithLabelValues(tenant, channel, "error").Inc()
+		return nil, fmt.Errorf("ad decision returned success=false")
+	}
+
+	// An empty decision is not an error - the channel's empty break policy applies
+	if len(resp.Data.Ads) == 0 {
+		log.Debug("No ads available")
+		metrics.AdDecisions.WithLabelValues(tenant, channel, "empty").Inc()
+		return nil, nil
+	}
+
+	log.Debug("Ad decision filled", "ads", len(resp.Data.Ads))
+	metrics.AdDecisions.WithLabelValues(tenant, channel, "filled").Inc()
+	return resp.Data.Ads, nil
+}
+
+// decisionRequest builds the ad decision request of a break and its cache key.
+// Cue breaks have IDs that are stable while the window slides; static break offsets
+// move with the window, so static decisions are shared per schedule slot instead.
+func (h *ManifestHandler) decisionRequest(tenant, channel string, tenantID int, adBreak models.AdBreak, v viewer) (models.AdDecisionRequest, string) {
+	device := v.UserAgent
+	if device == "" {
+		device = "Unknown"
+	}
+	// Truncate device string to max 100 characters to avoid Laravel validation error
+	if len(device) > 100 {
+		device = device[:100]
 	}
-	tenantID := channelInfo.TenantID
-	fmt.Printf("DEBUG: getAdsForBreak - tenant: %s, channel: %s, tenantID: %d, adBreak: %s (position: %s, offset: %.2f)\n", tenant, channel, tenantID, adBreak.ID, adBreak.Position, adBreak.Offset)
 
-	// Prepare ad decision request
 	req := models.AdDecisionRequest{
 		TenantID:        tenantID,
 		Channel:         channel,
 		AdBreakID:       adBreak.ID,
 		Position:        adBreak.Position,
 		DurationSeconds: adBreak.Duration,
-		Geo:             c.GetHeader("CF-IPCountry"), // Cloudflare header
-		Device: func() string {
-			device := c.GetHeader("User-Agent")
-			if device == "" {
-				device = "Unknown"
-			}
-			// Truncate device string to max 100 characters to avoid Laravel validation error
-			if len(device) > 100 {
-				device = device[:100]
-			}
-			return device
-		}(),
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Geo:             v.Geo,
+		Device:          device,
+		Timestamp:       time.Now().UTC().Format(time.RFC3339),
 	}
-	fmt.Printf("DEBUG: Ad decision request: %+v\n", req)
 
-	// Check cache for ad decision
-	cacheKey := fmt.Sprintf("ad_decision:%s:%s:%s", tenant, channel, adBreak.ID)
-	if cached, err := h.cache.Get(c.Request.Context(), cacheKey); err == nil && cached != "" {
-		// Parse cached response (simplified - in production use JSON unmarshaling)
-		// For now, skip cache for ad decisions
-	}
+	audience := service.AudienceSegment(v.SessionID, v.Geo, v.UserAgent)
 
-	// Call Laravel API
-	fmt.Printf("DEBUG: Calling Laravel API for ad decision...\n")
-	resp, err := h.laravelClient.GetAdDecision(c.Request.Context(), req)
-	if err != nil {
-		fmt.Printf("ERROR: Laravel API call failed: %v\n", err)
-		return nil, err
-	}
-
-	fmt.Printf("DEBUG: Laravel API response - Success: %v, Ads count: %d\n", resp.Success, len(resp.Data.Ads))
-	if len(resp.Data.Ads) > 0 {
-		fmt.Printf("DEBUG: First ad: ID=%d, VASTURL=%s\n", resp.Data.Ads[0].AdID, resp.Data.Ads[0].VASTURL)
-	}
+	return req, service.DecisionKey(tenant, channel, breakKey(adBreak), audience)
+}
 
-	if !resp.Success || len(resp.Data.Ads) == 0 {
-		fmt.Printf("WARN: No ads available - Success: %v, Ads count: %d\n", resp.Success, len(resp.Data.Ads))
-		return nil, fmt.Errorf("no ads available")
+// breakKey identifies a break across playlist refreshes. Cue break IDs are stable;
+// static breaks move with the window, so they are keyed by their schedule slot.
+func breakKey(adBreak models.AdBreak) string {
+	if adBreak.Type == "static" {
+		return "static_" + adBreak.Slot
 	}
-
-	// Cache ad decision (simplified)
-	// h.cache.Set(c.Request.Context(), cacheKey, "", h.config.Cache.AdDecisionTTL)
-
-	fmt.Printf("DEBUG: Returning %d ads for break %s\n", len(resp.Data.Ads), adBreak.ID)
-	return resp.Data.Ads, nil
+	return adBreak.ID
 }
 
 // emitTrackingEvents sends tracking events for ad impressions
-func (h *ManifestHandler) emitTrackingEvents(tenantID int, channelID int, channel string, ads []models.Ad, c *gin.Context) {
+func (h *ManifestHandler) emitTrackingEvents(ctx context.Context, tenantID int, channelID int, ads []models.Ad, v viewer) {
 	for _, ad := range ads {
-		fmt.Printf("DEBUG: Sending tracking event - tenantID: %d, channelID: %d, adID: %d\n", tenantID, channelID, ad.AdID)
 		event := models.TrackingEvent{
 			TenantID:   tenantID,
 			ChannelID:  channelID,
 			AdID:       ad.AdID,
 			EventType:  "impression",
-			SessionID:  c.Query("session_id"),
-			DeviceType: c.GetHeader("User-Agent"),
-			GeoCountry: c.GetHeader("CF-IPCountry"),
-			IPAddress:  c.ClientIP(),
-			UserAgent:  c.Request.UserAgent(),
+			SessionID:  v.SessionID,
+			DeviceType: v.UserAgent,
+			GeoCountry: v.Geo,
+			IPAddress:  v.ClientIP,
+			UserAgent:  v.UserAgent,
 			Timestamp:  time.Now().UTC().Format(time.RFC3339),
 		}
+		metrics.TrackingEvent(event.EventType, metrics.TrackingQueued)
 
-		if err := h.laravelClient.SendTrackingEvent(context.Background(), event); err != nil {
+		if err := h.laravelClient.SendTrackingEvent(ctx, event); err != nil {
 			// Log error but don't block
-			fmt.Printf("Failed to send tracking event: %v\n", err)
+			logging.FromContext(ctx).Error("Failed to send tracking event", logging.KeyAdID, ad.AdID, "error", err)
 		}
 	}
 }
 
-// rewriteManifestURLs rewrites relative URLs in manifest to absolute URLs
-// Also rewrites localhost:8000 to ads.wkkworld.com for ad HLS manifests
-// Note: We keep HTTP URLs as-is because origin CDN may not support HTTPS
-// HLS players (VLC, etc.) typically don't block mixed content like browsers do
-func (h *ManifestHandler) rewriteManifestURLs(manifest, originURL string, c *gin.Context) string {
+// rewriteManifestURLs rewrites relative URLs in a fetched manifest to absolute URLs and
+// applies the tenant's host rewrite rules (host_rewrites) to every URL
+func (h *ManifestHandler) rewriteManifestURLs(ctx context.Context, manifest, originURL string) string {
+	return hls.RewriteURIs(h.absoluteManifestURLs(ctx, manifest, originURL), urlrewrite.FromContext(ctx).Apply)
+}
+
+// absoluteManifestURLs rewrites relative URLs in manifest to absolute URLs
+func (h *ManifestHandler) absoluteManifestURLs(ctx context.Context, manifest, originURL string) string {
 	if originURL == "" {
-		fmt.Printf("WARNING: rewriteManifestURLs called with empty originURL\n")
+		logging.FromContext(ctx).Warn("absoluteManifestURLs called with empty originURL")
 		return manifest
 	}
 
-	// Rewrite localhost:8000 to ads.wkkworld.com (for ad HLS manifests)
-	manifest = strings.ReplaceAll(manifest, "http://localhost:8000", "https://ads.wkkworld.com")
-
-	// Note: We don't convert HTTP to HTTPS because:
-	// 1. Origin CDN may not support HTTPS
-	// 2. HLS players (VLC, OTT players) typically don't block mixed content
-	// 3. Mixed content (HTTP + HTTPS) is acceptable for HLS streaming
+	// Note: We don't convert HTTP to HTTPS here because the origin CDN may not support
+	// HTTPS; HTTPS web players use the cdn or proxy segment URL strategy (segment_urls)
 
 	// Parse origin URL to get base
 	originU, err := url.Parse(originURL)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to parse originURL=%s: %v\n", originURL, err)
+		logging.FromContext(ctx).Error("Failed to parse origin URL", "url", originURL, "error", err)
 		return manifest
 	}
 
@@ -511,7 +714,8 @@ func (h *ManifestHandler) rewriteManifestURLs(manifest, originURL string, c *gin
 }
 
 // generateStaticRulesFromChannel generates static ad rules from channel configuration
-func (h *ManifestHandler) generateStaticRulesFromChannel(channelInfo *models.ChannelInfo) []service.StaticAdRule {
+func (h *ManifestHandler) generateStaticRulesFromChannel(ctx context.Context, channelInfo *models.ChannelInfo) []service.StaticAdRule {
+	log := logging.FromContext(ctx)
 	rules := []service.StaticAdRule{}
 
 	// For ExoPlayer compatibility: skip pre-roll entirely
@@ -522,8 +726,7 @@ func (h *ManifestHandler) generateStaticRulesFromChannel(channelInfo *models.Cha
 	// Note: We skip pre-roll completely for ExoPlayer compatibility
 	// User can still get ads, but they'll start from the interval (e.g., 60 seconds)
 	if channelInfo.EnablePreRoll {
-		fmt.Printf("DEBUG: Pre-roll requested but skipped for ExoPlayer compatibility\n")
-		fmt.Printf("DEBUG: Ads will start from interval instead\n")
+		log.Debug("Pre-roll requested but skipped for ExoPlayer compatibility, ads start from the interval")
 	}
 
 	// Generate mid-roll breaks based on interval
@@ -540,8 +743,7 @@ func (h *ManifestHandler) generateStaticRulesFromChannel(channelInfo *models.Cha
 			Duration: 30,                                          // Default 30 seconds (Laravel requires >= 1)
 			Interval: float64(channelInfo.AdBreakIntervalSeconds), // Repeat every interval seconds
 		})
-		fmt.Printf("DEBUG: Generated interval mid-rolls every %.0f seconds (starting from %.0fs)\n",
-			interval, startOffset)
+		log.Debug("Generated interval mid-rolls", "interval", interval, "start_offset", startOffset)
 	} else if channelInfo.EnablePreRoll {
 		// If interval is 0 but pre-roll is enabled, add a default mid-roll at 60 seconds
 		// This ensures ads still appear even without interval configured
@@ -551,7 +753,7 @@ func (h *ManifestHandler) generateStaticRulesFromChannel(channelInfo *models.Cha
 			Duration: 30,   // Default 30 seconds
 			Interval: 0,    // No repeat
 		})
-		fmt.Printf("DEBUG: Generated default mid-roll at 60 seconds (no interval, pre-roll enabled)\n")
+		log.Debug("Generated default mid-roll at 60 seconds (no interval, pre-roll enabled)")
 	}
 
 	return rules
@@ -594,10 +796,3 @@ func (h *ManifestHandler) extractFirstMediaPlaylistURL(masterPlaylist, baseURL s
 
 	return "", fmt.Errorf("no media playlist URL found in master playlist")
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/internal/service"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+)
+
+// originPlaylist is the playlist a request is served from and where it came from
+type originPlaylist struct {
+	URL       string // origin playlist URL
+	Playlist  string // origin playlist as fetched
+	MediaURL  string // first media playlist of a master playlist ("" if none was found)
+	Media     string // media playlist to stitch ("" if a master's media playlist failed)
+	Unhealthy bool   // no origin was healthy; this is the first that could be fetched
+}
+
+// channelOrigins returns a channel's origins in priority order: those from Laravel, then
+// the configured backups, then the tenant's default origin
+func (h *ManifestHandler) channelOrigins(tenant, channel string, channelInfo *models.ChannelInfo) []string {
+	candidates := channelInfo.OriginURLs
+	if len(candidates) == 0 && channelInfo.HLSManifestURL != "" {
+		candidates = []string{channelInfo.HLSManifestURL}
+	}
+	candidates = append(append([]string{}, candidates...), h.config.ChannelSettingsFor(tenant, channel).Origins...)
+
+	seen := make(map[string]bool, len(candidates))
+	origins := make([]string, 0, len(candidates))
+	for _, origin := range candidates {
+		if origin != "" && !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		origins = append(origins, h.getOriginURL(tenant, channel))
+	}
+	return origins
+}
+
+// orderOrigins returns the order origins are tried in: healthy ones by priority, then
+// unhealthy ones as a last resort. Higher priority origins than the active one are only
+// tried again (failback) once the channel has been on it for failback_after.
+func (h *ManifestHandler) orderOrigins(ctx context.Context, origins []string, splice *service.OriginSplice) []string {
+	activeIndex := -1
+	canFailBack := true
+	if splice != nil {
+		for i, origin := range origins {
+			if origin == splice.Origin {
+				activeIndex = i
+				break
+			}
+		}
+		canFailBack = time.Since(splice.SwitchedAt) >= h.originHealth.FailbackAfter()
+	}
+
+	ordered := make([]string, 0, len(origins))
+	var deferred []string
+	for i, origin := range origins {
+		if !h.originHealth.Healthy(ctx, origin) || (i < activeIndex && !canFailBack) {
+			deferred = append(deferred, origin)
+			continue
+		}
+		ordered = append(ordered, origin)
+	}
+	return append(ordered, deferred...)
+}
+
+// fetchOrigin fetches a channel's playlist, failing over to the next origin when one
+// fails or its live playlist is unhealthy (stale, or with an issue configured to fail
+// over on). If no origin is fully healthy, the first playlist that could be fetched is
+// returned marked Unhealthy, for the caller to tag as degraded.
+func (h *ManifestHandler) fetchOrigin(ctx context.Context, tenant, channel string, origins []string, splice *service.OriginSplice) (*originPlaylist, error) {
+	log := logging.FromContext(ctx)
+
+	var fallback *originPlaylist
+	var lastErr error
+	for _, origin := range h.orderOrigins(ctx, origins, splice) {
+		playlist, err := h.fetchFromOrigin(ctx, tenant, channel, origin)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			log.Warn("Origin failed, trying next", "origin_url", origin, "error", err)
+			h.originHealth.Failure(ctx, origin)
+			lastErr = err
+			continue
+		}
+
+		if playlist.Media == "" {
+			log.Warn("Origin master playlist has no usable media playlist, trying next", "origin_url", origin)
+			h.originHealth.Failure(ctx, origin)
+		} else if !h.playlistHealthy(ctx, tenant, channel, origin, playlist.Media) {
+			log.Warn("Origin playlist is unhealthy, trying next", "origin_url", origin)
+		} else {
+			return playlist, nil
+		}
+
+		if fallback == nil {
+			fallback = playlist
+		}
+	}
+
+	if fallback != nil {
+		fallback.Unhealthy = true
+		return fallback, nil
+	}
+	return nil, lastErr
+}
+
+// playlistHealthy runs the playlist health checks on a polled media playlist and reports
+// whether the origin may serve it: it isn't stale and has none of the issues configured
+// to fail over on. Unhealthy origins are taken out of rotation.
+func (h *ManifestHandler) playlistHealthy(ctx context.Context, tenant, channel, originURL, media string) bool {
+	var issues []string
+	if h.playlistMonitor != nil {
+		issues = h.playlistMonitor.Check(ctx, tenant, channel, originURL, media)
+	}
+
+	if h.originHealth.Observe(ctx, originURL, hls.ScanWindow(media)) {
+		return false
+	}
+	if h.playlistMonitor != nil && h.playlistMonitor.FailsOver(issues) {
+		logging.FromContext(ctx).Warn("Failing over on playlist issues", "origin_url", originURL, "issues", issues)
+		h.originHealth.Unhealthy(ctx, originURL)
+		return false
+	}
+	return true
+}
+
+// fetchFromOrigin fetches the playlist at originURL and, for a master playlist, its first
+// media playlist
+func (h *ManifestHandler) fetchFromOrigin(ctx context.Context, tenant, channel, originURL string) (*originPlaylist, error) {
+	playlist, err := h.fetchOriginManifest(ctx, tenant, channel, originURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &originPlaylist{URL: originURL, Playlist: playlist}
+	if !strings.Contains(playlist, "#EXT-X-STREAM-INF") {
+		result.Media = playlist
+		return result, nil
+	}
+
+	mediaURL, err := h.extractFirstMediaPlaylistURL(playlist, originURL)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to extract media playlist URL", "origin_url", originURL, "error", err)
+		return result, nil
+	}
+	result.MediaURL = mediaURL
+
+	media, err := h.fetchOriginManifest(ctx, tenant, channel, mediaURL)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to fetch media playlist", "url", mediaURL, "error", err)
+		return result, nil
+	}
+	result.Media = media
+	return result, nil
+}
+
+// spliceOrigin numbers a channel's media playlist continuously across origin switches,
+// marking each switch with a discontinuity
+func (h *ManifestHandler) spliceOrigin(ctx context.Context, tenant, channel string, splice *service.OriginSplice, originURL, media string) string {
+	spliced, switched := h.splicer.Splice(ctx, tenant+"/"+channel, splice, originURL, media)
+	if switched {
+		metrics.OriginFailovers.WithLabelValues(tenant, channel).Inc()
+		logging.FromContext(ctx).Warn("Switched origin", "from", splice.Origin, "to", originURL)
+	}
+	return spliced
+}
+
+// getOriginURL returns the default origin of a channel on the tenant's origin CDN
+// (origins.<tenant>, or origins.default)
+func (h *ManifestHandler) getOriginURL(tenant, channel string) string {
+	base := h.config.Origins[tenant]
+	if base == "" {
+		base = h.config.Origins["default"]
+	}
+	if base == "" {
+		base = "https://cdn.example.com"
+	}
+	return fmt.Sprintf("%s/hls/%s/%s.m3u8", strings.TrimSuffix(base, "/"), tenant, channel)
+}
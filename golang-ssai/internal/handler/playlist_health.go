@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type PlaylistHealthHandler struct {
+	monitor *service.PlaylistMonitor
+}
+
+func NewPlaylistHealthHandler(monitor *service.PlaylistMonitor) *PlaylistHealthHandler {
+	return &PlaylistHealthHandler{monitor: monitor}
+}
+
+// Status handles GET /admin/playlist-health?tenant=&channel=&unhealthy=true
+func (h *PlaylistHealthHandler) Status(c *gin.Context) {
+	statuses, err := h.monitor.Statuses(c.Request.Context(), c.Query("tenant"), c.Query("channel"), c.Query("unhealthy") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    statuses,
+		"total":   len(statuses),
+	})
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPeekedTrackingBody bounds how much of a tracking body is read for rate limit keys
+const maxPeekedTrackingBody = 64 << 10
+
+// Rate limit buckets
+const (
+	bucketIP      = "ip"
+	bucketTenant  = "tenant"
+	bucketSession = "session"
+)
+
+// resolvedTenantKey holds the ID of the tenant whose channel a manifest request resolved to
+const resolvedTenantKey = "resolved_tenant"
+
+// rateLimitKeys returns the tenant and session of a request ("" when unknown)
+type rateLimitKeys func(c *gin.Context) (tenant, session string)
+
+// ManifestRateLimit limits manifest requests per client IP and session.
+// rate_limiting.requests_per_minute is the per-IP limit unless manifest.per_ip is set.
+// Per tenant limits are ManifestTenantRateLimit's.
+func ManifestRateLimit(cfg *config.Config, limiter ratelimit.Limiter) gin.HandlerFunc {
+	rules := cfg.RateLimiting.Manifest
+	if rules.PerIP.RequestsPerMinute == 0 {
+		rules.PerIP.RequestsPerMinute = cfg.RateLimiting.RequestsPerMinute
+	}
+	rules.PerTenant = config.RateLimit{}
+
+	return rateLimit("manifest", limiter, rules, func(c *gin.Context) (string, string) {
+		return "", c.Query("session_id")
+	})
+}
+
+// ManifestTenantRateLimit limits manifest requests per tenant. The tenant in the URL
+// is anyone's to pick, so the manifest handler applies this once the channel is
+// resolved (keyed by its tenant ID, see ManifestHandler.LimitTenants).
+func ManifestTenantRateLimit(cfg *config.Config, limiter ratelimit.Limiter) gin.HandlerFunc {
+	rules := config.RateLimitRules{PerTenant: cfg.RateLimiting.Manifest.PerTenant}
+	return rateLimit("manifest", limiter, rules, func(c *gin.Context) (string, string) {
+		return c.GetString(resolvedTenantKey), ""
+	})
+}
+
+// TrackingIPRateLimit limits tracking requests per client IP. It runs before
+// TrackingAuth, so API key guessing is limited too.
+func TrackingIPRateLimit(cfg *config.Config, limiter ratelimit.Limiter) gin.HandlerFunc {
+	rules := config.RateLimitRules{PerIP: cfg.RateLimiting.Tracking.PerIP}
+	return rateLimit("tracking", limiter, rules, func(c *gin.Context) (string, string) {
+		return "", ""
+	})
+}
+
+// TrackingRateLimit limits authenticated tracking events per tenant and session,
+// separately from manifests (per IP limits are TrackingIPRateLimit's)
+func TrackingRateLimit(cfg *config.Config, limiter ratelimit.Limiter) gin.HandlerFunc {
+	rules := cfg.RateLimiting.Tracking
+	rules.PerIP = config.RateLimit{}
+	return rateLimit("tracking", limiter, rules, trackingRateLimitKeys)
+}
+
+// trackingRateLimitKeys returns the authenticated tenant of a tracking event (see
+// TrackingAuth) and its session, peeking at the body (leaving it intact for the handler)
+// when the credentials don't pin one
+func trackingRateLimitKeys(c *gin.Context) (string, string) {
+	p, ok := trackingPrincipalFrom(c)
+	if !ok {
+		return "", ""
+	}
+	tenant := strconv.Itoa(p.TenantID)
+	if p.SessionID != "" {
+		return tenant, p.SessionID
+	}
+
+	peeked, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekedTrackingBody))
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(peeked), c.Request.Body), c.Request.Body}
+	if err != nil {
+		return tenant, ""
+	}
+
+	var event struct {
+		SessionID string `json:"session_id"`
+	}
+	if json.Unmarshal(peeked, &event) != nil {
+		return tenant, ""
+	}
+	return tenant, event.SessionID
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// rateLimit takes a token from each configured bucket of the request, rejecting it
+// with 429 and Retry-After as soon as one is empty. Limiter errors let requests through.
+// It doesn't call c.Next, so handlers can also apply it inline and check c.IsAborted.
+func rateLimit(scope string, limiter ratelimit.Limiter, rules config.RateLimitRules, keys rateLimitKeys) gin.HandlerFunc {
+	type rule struct {
+		bucket string
+		limit  ratelimit.Limit
+	}
+
+	var enabled []rule
+	for _, r := range []struct {
+		bucket string
+		limit  config.RateLimit
+	}{
+		{bucketIP, rules.PerIP},
+		{bucketTenant, rules.PerTenant},
+		{bucketSession, rules.PerSession},
+	} {
+		if limit, ok := ratelimit.LimitFrom(r.limit); ok {
+			enabled = append(enabled, rule{bucket: r.bucket, limit: limit})
+		}
+	}
+
+	return func(c *gin.Context) {
+		if len(enabled) == 0 {
+			return
+		}
+
+		tenant, session := keys(c)
+		values := map[string]string{
+			bucketIP:      c.ClientIP(),
+			bucketTenant:  tenant,
+			bucketSession: session,
+		}
+
+		ctx := c.Request.Context()
+		for _, r := range enabled {
+			value := values[r.bucket]
+			if value == "" {
+				continue
+			}
+
+			result, err := limiter.Allow(ctx, "ratelimit:"+scope+":"+r.bucket+":"+value, r.limit)
+			if err != nil {
+				logging.FromContext(ctx).Warn("Rate limiter unavailable, allowing request", "scope", scope, "error", err)
+				continue
+			}
+			if !result.Allowed {
+				metrics.RateLimited.WithLabelValues(scope, r.bucket).Inc()
+				retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				c.Header("Retry-After", strconv.Itoa(retryAfter))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+				return
+			}
+		}
+	}
+}
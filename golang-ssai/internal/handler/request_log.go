@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+const maxRequestIDLength = 64
+
+// RequestLogger gives each request an ID (X-Request-ID, generated if missing), puts a logger
+// carrying it in the request context and writes one access log line per request.
+// Probes and metrics scrapes are logged at debug level.
+func RequestLogger(cfg *config.Config) gin.HandlerFunc {
+	quiet := quietRoutes(cfg)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = newRequestID()
+		}
+		c.Header("X-Request-ID", requestID)
+
+		ctx := logging.WithLogger(c.Request.Context(), slog.Default().With(logging.KeyRequestID, requestID))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		// Handlers may have added request fields (tenant, channel...) to the context
+		ctx = c.Request.Context()
+		level := slog.LevelInfo
+		if quiet[c.FullPath()] {
+			level = slog.LevelDebug
+		}
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelWarn
+		}
+
+		logging.FromContext(ctx).Log(ctx, level, "request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// quietRoutes are the probe and metrics routes, hit every few seconds by infrastructure
+func quietRoutes(cfg *config.Config) map[string]bool {
+	metricsPath := cfg.Metrics.Path
+	if metricsPath == "" {
+		metricsPath = "/metrics"
+	}
+	return map[string]bool{
+		"/health":       true,
+		"/health/live":  true,
+		"/health/ready": true,
+		metricsPath:     true,
+	}
+}
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/creative"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/internal/parser"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultStitchConcurrency = 8
+	defaultStitchDeadline    = 2 * time.Second
+)
+
+// viewer is a snapshot of the request fields used for ad decisions and tracking,
+// safe to use from goroutines that outlive the request
+type viewer struct {
+	UserAgent string
+	Geo       string
+	SessionID string
+	ClientIP  string
+}
+
+func newViewer(c *gin.Context) viewer {
+	return viewer{
+		UserAgent: c.GetHeader("User-Agent"),
+		Geo:       c.GetHeader("CF-IPCountry"), // Cloudflare header
+		SessionID: c.Query("session_id"),
+		ClientIP:  c.ClientIP(),
+	}
+}
+
+// stitchDeadline is the latency budget for resolving the ads of a manifest request
+func (h *ManifestHandler) stitchDeadline() time.Duration {
+	if h.config.Stitching.Deadline > 0 {
+		return h.config.Stitching.Deadline
+	}
+	return defaultStitchDeadline
+}
+
+func (h *ManifestHandler) stitchConcurrency() int {
+	if h.config.Stitching.MaxConcurrency > 0 {
+		return h.config.Stitching.MaxConcurrency
+	}
+	return defaultStitchConcurrency
+}
+
+// acquire takes a worker slot, giving up when ctx is done
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// prefetchDecisions requests the decisions of upcoming breaks in the background, so
+// they're cached by the time the breaks show up in the window
+func (h *ManifestHandler) prefetchDecisions(ctx context.Context, tenant, channel string, tenantID int, adBreaks []models.AdBreak, v viewer) {
+	for _, adBreak := range adBreaks {
+		req, cacheKey := h.decisionRequest(tenant, channel, tenantID, adBreak, v)
+		logging.FromContext(ctx).Debug("Prefetching ad decision for upcoming break", logging.KeyBreakID, adBreak.ID)
+		h.decisions.Prefetch(cacheKey, req)
+	}
+}
+
+type breakResult struct {
+	index int
+	ads   []models.Ad
+	err   error
+}
+
+// resolveDecisions gets the ad decision of every break in parallel. It also returns the
+// IDs of the breaks whose decision was requested (not only prefetched, nor cut by the deadline).
+// Breaks whose decision isn't back by the deadline are skipped.
+func (h *ManifestHandler) resolveDecisions(ctx context.Context, tenant, channel string, tenantID int, adBreaks []models.AdBreak, slate config.SlateConfig, v viewer) ([]parser.AdBreakWithAds, map[string]bool) {
+	log := logging.FromContext(ctx)
+	sem := make(chan struct{}, h.stitchConcurrency())
+	results := make(chan breakResult, len(adBreaks)) // buffered so late workers never block
+	requested := make([]atomic.Bool, len(adBreaks))
+	pending := 0
+
+	for i, adBreak := range adBreaks {
+		// A CUE-OUT at the live edge has no avail segments yet: prefetch its decision
+		// so it's cached by the time the avail shows up in the window
+		if adBreak.Type == "scte35" && !adBreak.SpanUnknown && adBreak.EndIndex <= adBreak.StartIndex {
+			h.prefetchDecisions(ctx, tenant, channel, tenantID, []models.AdBreak{adBreak}, v)
+			continue
+		}
+
+		pending++
+		go func(i int, adBreak models.AdBreak) {
+			if !acquire(ctx, sem) {
+				results <- breakResult{index: i, err: ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
+
+			requested[i].Store(true)
+			ads, err := h.getAdsForBreak(ctx, tenant, channel, tenantID, adBreak, v)
+			results <- breakResult{index: i, ads: ads, err: err}
+		}(i, adBreak)
+	}
+
+	resolved := make(map[int]breakResult, pending)
+	for len(resolved) < pending {
+		select {
+		case r := <-results:
+			resolved[r.index] = r
+		case <-ctx.Done():
+			log.Warn("Stitch deadline reached before all ad decisions", "resolved", len(resolved), "pending", pending)
+			pending = len(resolved)
+		}
+	}
+
+	// Keep breaks in detection order
+	adBreaksWithAds := make([]parser.AdBreakWithAds, 0, len(resolved))
+	requestedIDs := make(map[string]bool, len(adBreaks))
+	for i, adBreak := range adBreaks {
+		if requested[i].Load() {
+			requestedIDs[adBreak.ID] = true
+		}
+		r, ok := resolved[i]
+		if !ok {
+			continue
+		}
+		if r.err != nil {
+			log.Error("Failed to get ads for break", logging.KeyBreakID, adBreak.ID, "error", r.err)
+			continue // Skip this break if error
+		}
+		if len(r.ads) == 0 {
+			if slate.EmptyBreakPolicy == config.EmptyBreakSlate && slate.URL != "" && adBreak.Duration > 0 {
+				// Full-slate break: the stitcher pads the empty pod to the break duration
+				log.Debug("Filling empty break with slate", logging.KeyBreakID, adBreak.ID, "duration", adBreak.Duration)
+				adBreaksWithAds = append(adBreaksWithAds, h.newAdBreakWithAds(adBreak, nil))
+			}
+			continue // No impressions to track
+		}
+
+		adBreaksWithAds = append(adBreaksWithAds, h.newAdBreakWithAds(adBreak, r.ads))
+	}
+
+	return adBreaksWithAds, requestedIDs
+}
+
+type adResult struct {
+	breakIndex int
+	adIndex    int
+	ad         models.Ad
+	ok         bool
+}
+
+// resolveAds fetches the VAST and HLS manifest of every ad of every break in parallel.
+// Ads that fail or aren't resolved by the deadline are dropped from their pod;
+// the break itself is kept so the slate can fill the gap.
+func (h *ManifestHandler) resolveAds(ctx context.Context, tenant, channel string, adBreaks []parser.AdBreakWithAds, profile creative.Profile) []parser.AdBreakWithAds {
+	total := 0
+	for _, adBreak := range adBreaks {
+		total += len(adBreak.Ads)
+	}
+
+	sem := make(chan struct{}, h.stitchConcurrency())
+	results := make(chan adResult, total) // buffered so late workers never block
+
+	for bi, adBreak := range adBreaks {
+		for ai, ad := range adBreak.Ads {
+			go func(bi, ai int, ad models.Ad) {
+				if !acquire(ctx, sem) {
+					results <- adResult{breakIndex: bi, adIndex: ai}
+					return
+				}
+				defer func() { <-sem }()
+
+				resolvedAd, ok := h.resolveAd(ctx, tenant, channel, ad, profile)
+				results <- adResult{breakIndex: bi, adIndex: ai, ad: resolvedAd, ok: ok}
+			}(bi, ai, ad)
+		}
+	}
+
+	resolved := make([][]*models.Ad, len(adBreaks))
+	for bi, adBreak := range adBreaks {
+		resolved[bi] = make([]*models.Ad, len(adBreak.Ads))
+	}
+
+	for received := 0; received < total; received++ {
+		select {
+		case r := <-results:
+			if r.ok {
+				ad := r.ad
+				resolved[r.breakIndex][r.adIndex] = &ad
+			}
+		case <-ctx.Done():
+			logging.FromContext(ctx).Warn("Stitch deadline reached, dropping unresolved ads", "resolved", received, "total", total)
+			received = total
+		}
+	}
+
+	// Keep ads in ad-server priority order
+	processed := make([]parser.AdBreakWithAds, len(adBreaks))
+	for bi, adBreak := range adBreaks {
+		ads := make([]models.Ad, 0, len(adBreak.Ads))
+		for _, ad := range resolved[bi] {
+			if ad != nil {
+				ads = append(ads, *ad)
+			}
+		}
+		adBreak.Ads = ads
+		processed[bi] = adBreak
+	}
+
+	return processed
+}
+
+// resolveAd fetches the HLS manifest of an ad (through its VAST if needed) and stores the
+// rewritten manifest content in ad.VASTURL for the stitcher. Returns false if the ad can't be played.
+func (h *ManifestHandler) resolveAd(ctx context.Context, tenant, channel string, ad models.Ad, profile creative.Profile) (models.Ad, bool) {
+	ctx, span := tracing.Start(ctx, "resolve_ad", attribute.Int("ad.id", ad.AdID))
+	defer span.End()
+
+	ctx = logging.With(ctx, logging.KeyAdID, ad.AdID)
+	log := logging.FromContext(ctx)
+
+	// Already an HLS manifest URL - fetch and rewrite
+	if strings.HasSuffix(strings.ToLower(ad.VASTURL), ".m3u8") {
+		adManifest, err := h.fetchAdManifest(ctx, ad.VASTURL)
+		if err != nil {
+			log.Error("Failed to fetch ad manifest", "url", ad.VASTURL, "error", err)
+			return ad, false
+		}
+		// Store rewritten manifest content in VASTURL
+		ad.VASTURL = h.rewriteManifestURLs(ctx, adManifest, ad.VASTURL)
+		return ad, true
+	}
+
+	// Otherwise fetch VAST and extract HLS manifest
+	vastInfo, err := h.vastParser.ProcessVAST(ctx, ad.VASTURL)
+	if err != nil {
+		log.Error("Failed to process VAST", "url", ad.VASTURL, "error", err)
+		metrics.VASTErrors.WithLabelValues(tenant, channel, strconv.Itoa(parser.VASTErrorCode(err))).Inc()
+		return ad, false
+	}
+
+	// Extract HLS manifest URL from VAST, conditioning MP4-only creatives into HLS
+	hlsURL := vastInfo.HLSManifestURL
+	if hlsURL == "" && vastInfo.MP4URL != "" {
+		hlsURL = h.resolveMP4Creative(ctx, vastInfo, profile)
+	}
+	if hlsURL == "" {
+		log.Error("No video URL found in VAST", "url", ad.VASTURL)
+		metrics.VASTErrors.WithLabelValues(tenant, channel, strconv.Itoa(parser.VASTErrorMediaFile)).Inc()
+		return ad, false
+	}
+
+	log.Debug("Extracted HLS manifest from VAST", "url", hlsURL)
+
+	// Fetch ad manifest and rewrite relative URLs to absolute
+	adManifest, err := h.fetchAdManifest(ctx, hlsURL)
+	if err != nil {
+		log.Error("Failed to fetch ad manifest", "url", hlsURL, "error", err)
+		return ad, false
+	}
+	adManifest = h.rewriteManifestURLs(ctx, adManifest, hlsURL)
+
+	// Store rewritten manifest content in VASTURL (temporary, will be used by stitcher)
+	ad.VASTURL = adManifest
+	return ad, true
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// segmentProxyHeaderTimeout bounds the wait for upstream response headers; bodies are
+// streamed for as long as the player reads them
+const segmentProxyHeaderTimeout = 10 * time.Second
+
+// maxSegmentProxyRedirects bounds the upstream redirects followed for a segment
+const maxSegmentProxyRedirects = 5
+
+// Headers passed from the player to the upstream and back
+var (
+	proxyRequestHeaders  = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+	proxyResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+		"ETag", "Last-Modified", "Cache-Control", "Expires"}
+)
+
+// SegmentProxyHandler serves segments through the service for tenants with the proxy
+// segment URL strategy, e.g. to keep HTTPS players off plain HTTP origins
+type SegmentProxyHandler struct {
+	config *config.Config
+	client *http.Client
+}
+
+func NewSegmentProxyHandler(cfg *config.Config) *SegmentProxyHandler {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = segmentProxyHeaderTimeout
+
+	return &SegmentProxyHandler{
+		config: cfg,
+		client: &http.Client{
+			Transport:     metrics.InstrumentTransport("segment_proxy", tracing.Transport(transport)),
+			CheckRedirect: checkSegmentRedirect,
+		},
+	}
+}
+
+// checkSegmentRedirect only follows upstream redirects to public http(s) hosts, so a
+// signed segment URL can't be bounced onto internal services
+func checkSegmentRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxSegmentProxyRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxSegmentProxyRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to %s URL refused", req.URL.Scheme)
+	}
+
+	host := req.URL.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(req.Context(), host)
+		if err != nil {
+			return err
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return errors.New("redirect to non-public address refused")
+		}
+	}
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// Serve handles GET and HEAD /segments/{tenant}/{bind}/{expires}/{signature}/{target}/{name},
+// streaming the upstream response (including partial content for range requests)
+func (h *SegmentProxyHandler) Serve(c *gin.Context) {
+	tenant := c.Param("tenant")
+	expires := c.Param("expires")
+	target := c.Param("target")
+
+	settings := h.config.SegmentURLsFor(tenant)
+	if settings.Strategy != config.SegmentURLProxy || settings.ProxySecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Segment proxy is disabled"})
+		return
+	}
+	if !h.validSignature(c, settings.ProxySecret, tenant, expires, target) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid segment signature"})
+		return
+	}
+	if expiresAt, err := strconv.ParseInt(expires, 10, 64); err != nil || time.Now().Unix() > expiresAt {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Segment URL expired"})
+		return
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(target)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment URL"})
+		return
+	}
+	upstream, err := url.Parse(string(raw))
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment URL"})
+		return
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, upstream.String(), nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment URL"})
+		return
+	}
+	for _, name := range proxyRequestHeaders {
+		if value := c.GetHeader(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Warn("Segment proxy upstream failed", "url", upstream.String(), "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch segment"})
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, name := range proxyResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "Range")
+	c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Range")
+	c.Status(resp.StatusCode)
+
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		// Usually the player went away mid-segment
+		logging.FromContext(c.Request.Context()).Debug("Segment proxy copy ended early", "url", upstream.String(), "error", err)
+	}
+}
+
+// validSignature checks the signature of a proxied segment URL. URLs bound to a viewer
+// IP (see segmentBinding) only verify from that IP; unbound ones verify from any.
+func (h *SegmentProxyHandler) validSignature(c *gin.Context, secret, tenant, expires, target string) bool {
+	bind := c.Param("bind")
+	ip := ""
+	switch bind {
+	case proxyBindIP:
+		ip = c.ClientIP()
+	case proxyBindNone:
+	default:
+		return false
+	}
+	want := proxySignature(secret, tenant, bind, expires, target, ip, c.Query("session_id"))
+	return hmac.Equal([]byte(c.Param("signature")), []byte(want))
+}
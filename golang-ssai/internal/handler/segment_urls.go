@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+	"github.com/fast-ads-backend/golang-ssai/pkg/urlsign"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultProxyURLTTL is how long proxied segment URLs are valid when
+// segment_urls.proxy_url_ttl is unset
+const defaultProxyURLTTL = 10 * time.Minute
+
+// segmentBindingKey is the gin context key of the viewer proxied segment URLs are bound to
+const segmentBindingKey = "segment_binding"
+
+// Binding modes of proxied segment URLs (signed, so only the issued mode verifies)
+const (
+	proxyBindIP   = "ip"  // valid from the viewer IP the playlist was requested from
+	proxyBindNone = "any" // valid from any IP
+)
+
+// segmentBinding is what the proxied segment URLs of a playlist are bound to, for
+// channels that require signed URLs (see verifyPlaybackToken)
+type segmentBinding struct {
+	ExpiresAt time.Time // the playback token's expiry; proxied URLs never outlive it
+	IP        string    // viewer IP ("" unless the channel binds signed URLs to IPs)
+	Session   string    // session_id of the playlist request ("" if it has none)
+}
+
+// segmentBindingFrom returns the binding of a request's proxied segment URLs (none for
+// channels that don't sign URLs)
+func segmentBindingFrom(c *gin.Context) segmentBinding {
+	v, ok := c.Get(segmentBindingKey)
+	if !ok {
+		return segmentBinding{}
+	}
+	binding, _ := v.(segmentBinding)
+	return binding
+}
+
+// rewriteSegmentURLs points the segments of a playlist (and its keys and init sections)
+// at the tenant's CDN or at the segment proxy, depending on its segment URL strategy
+func (h *ManifestHandler) rewriteSegmentURLs(c *gin.Context, tenant, manifest string) string {
+	settings := h.config.SegmentURLsFor(tenant)
+
+	switch settings.Strategy {
+	case config.SegmentURLCDN:
+		return hls.RewriteURIs(manifest, func(uri string) string {
+			return applyCDNRules(settings.CDNRules, uri)
+		})
+	case config.SegmentURLProxy:
+		// Unsigned proxy URLs would make the proxy an open relay. Degraded master playlists
+		// aren't proxied: the variants' relative segment URLs would resolve to the proxy.
+		if settings.ProxySecret == "" || strings.Contains(manifest, "#EXT-X-STREAM-INF") {
+			return manifest
+		}
+		base := settings.ProxyBaseURL
+		if base == "" {
+			base = requestBaseURL(c, h.config.Server.TrustedProxies)
+		}
+
+		ttl := settings.ProxyURLTTL
+		if ttl <= 0 {
+			ttl = defaultProxyURLTTL
+		}
+		binding := segmentBindingFrom(c)
+		expiresAt := time.Now().Add(ttl)
+		if !binding.ExpiresAt.IsZero() && binding.ExpiresAt.Before(expiresAt) {
+			expiresAt = binding.ExpiresAt
+		}
+
+		return hls.RewriteURIs(manifest, func(uri string) string {
+			return proxySegmentURL(base, settings.ProxySecret, tenant, uri, expiresAt.Unix(), binding)
+		})
+	default:
+		return manifest
+	}
+}
+
+// applyCDNRules rewrites uri with the first rule whose prefix it starts with
+func applyCDNRules(rules []config.CDNRule, uri string) string {
+	for _, rule := range rules {
+		if rule.Match != "" && strings.HasPrefix(uri, rule.Match) {
+			return rule.Replace + strings.TrimPrefix(uri, rule.Match)
+		}
+	}
+	return uri
+}
+
+// proxySegmentURL returns the URL segment uri is proxied at, valid until expires:
+// <base>/segments/<tenant>/<bind>/<expires>/<signature>/<base64url target>/<file name>,
+// where bind is the binding mode. The file name keeps the extension for players that sniff it.
+func proxySegmentURL(base, secret, tenant, uri string, expires int64, binding segmentBinding) string {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return uri
+	}
+
+	target := base64.RawURLEncoding.EncodeToString([]byte(uri))
+	name := path.Base(u.Path)
+	if name == "" || name == "." || name == "/" {
+		name = "segment"
+	}
+	bind := proxyBindNone
+	if binding.IP != "" {
+		bind = proxyBindIP
+	}
+	expiresParam := strconv.FormatInt(expires, 10)
+	return fmt.Sprintf("%s/segments/%s/%s/%s/%s/%s/%s", strings.TrimSuffix(base, "/"), url.PathEscape(tenant),
+		bind, expiresParam, proxySignature(secret, tenant, bind, expiresParam, target, binding.IP, binding.Session),
+		target, url.PathEscape(name))
+}
+
+// proxySignature signs a proxied segment URL: its tenant, binding mode, expiry and
+// target, and the viewer IP and session it's bound to ("" when unbound)
+func proxySignature(secret, tenant, bind, expires, target, ip, session string) string {
+	return urlsign.Sign(secret, tenant, bind, expires, target, ip, session)
+}
+
+// requestBaseURL returns the scheme and host the request reached the service at, for
+// tenants without a proxy_base_url. X-Forwarded-Proto is only honored from a trusted
+// (TLS-terminating) load balancer.
+func requestBaseURL(c *gin.Context, trustedProxies []string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" && trustedProxy(trustedProxies, c.RemoteIP()) {
+		switch proto = strings.TrimSpace(strings.Split(proto, ",")[0]); proto {
+		case "http", "https":
+			scheme = proto
+		}
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// trustedProxy reports whether ip is one of the proxies (IPs or CIDRs, see
+// server.trusted_proxies)
+func trustedProxy(proxies []string, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
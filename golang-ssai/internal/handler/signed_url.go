@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/pkg/urlsign"
+	"github.com/gin-gonic/gin"
+)
+
+// verifyPlaybackToken checks the signed URL of a manifest request for channels that
+// require one, aborting the request on failure. It returns the query to propagate to
+// every URI of the returned playlist (nil when the channel doesn't sign URLs).
+func verifyPlaybackToken(c *gin.Context, cfg *config.Config, channelInfo *models.ChannelInfo) (url.Values, bool) {
+	if !channelInfo.RequireSignedURLs {
+		return nil, true
+	}
+
+	log := logging.FromContext(c.Request.Context())
+	if channelInfo.URLSigningSecret == "" {
+		log.Error("Channel requires signed URLs but has no signing secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "URL signing is misconfigured"})
+		return nil, false
+	}
+
+	ip := ""
+	if channelInfo.SignedURLBindIP {
+		// Behind a load balancer the viewer's IP is only known from proxies that are
+		// trusted to forward it; without any, IP binding is refused rather than guessed
+		if len(cfg.Server.TrustedProxies) == 0 {
+			log.Error("Channel binds signed URLs to the viewer IP but server.trusted_proxies is not set")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "URL signing is misconfigured"})
+			return nil, false
+		}
+		ip = c.ClientIP()
+	}
+
+	expires := c.Query(urlsign.ParamExpires)
+	token := c.Query(urlsign.ParamToken)
+	sessionID := c.Query("session_id")
+
+	err := urlsign.Verify(channelInfo.URLSigningSecret, c.Request.URL.Path, expires, token, ip, sessionID, time.Now())
+	if err != nil {
+		if !errors.Is(err, urlsign.ErrMissing) {
+			log.Info("Rejected signed URL", "error", err)
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired token"})
+		return nil, false
+	}
+
+	// Proxied segment URLs are bound to the same viewer and expire with the token
+	expiresAt, _ := strconv.ParseInt(expires, 10, 64)
+	c.Set(segmentBindingKey, segmentBinding{ExpiresAt: time.Unix(expiresAt, 0), IP: ip, Session: sessionID})
+
+	query := url.Values{}
+	if sessionID != "" {
+		query.Set("session_id", sessionID)
+	}
+	query.Set(urlsign.ParamExpires, expires)
+	query.Set(urlsign.ParamToken, token)
+	return query, true
+}
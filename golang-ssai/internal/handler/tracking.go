@@ -6,6 +6,7 @@ import (
 
 	"github.com/fast-ads-backend/golang-ssai/internal/client"
 	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
 	"github.com/fast-ads-backend/golang-ssai/internal/models"
 	"github.com/gin-gonic/gin"
 )
@@ -15,8 +16,7 @@ type TrackingHandler struct {
 	laravelClient *client.LaravelClient
 }
 
-func NewTrackingHandler(cfg *config.Config) *TrackingHandler {
-	laravelClient := client.NewLaravelClient(cfg)
+func NewTrackingHandler(cfg *config.Config, laravelClient *client.LaravelClient) *TrackingHandler {
 	return &TrackingHandler{
 		config:        cfg,
 		laravelClient: laravelClient,
@@ -30,11 +30,15 @@ func (h *TrackingHandler) TrackImpression(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !applyTrackingPrincipal(c, &event) {
+		return
+	}
 
 	event.EventType = "impression"
 	event.Timestamp = time.Now().UTC().Format(time.RFC3339)
 	event.IPAddress = c.ClientIP()
 	event.UserAgent = c.GetHeader("User-Agent")
+	metrics.TrackingEvent(event.EventType, metrics.TrackingQueued)
 
 	// Send to Laravel (async in production)
 	if err := h.laravelClient.SendTrackingEvent(c.Request.Context(), event); err != nil {
@@ -52,10 +56,14 @@ func (h *TrackingHandler) TrackQuartile(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !applyTrackingPrincipal(c, &event) {
+		return
+	}
 
 	event.Timestamp = time.Now().UTC().Format(time.RFC3339)
 	event.IPAddress = c.ClientIP()
 	event.UserAgent = c.GetHeader("User-Agent")
+	metrics.TrackingEvent(event.EventType, metrics.TrackingQueued)
 
 	if err := h.laravelClient.SendTrackingEvent(c.Request.Context(), event); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track event"})
@@ -72,11 +80,15 @@ func (h *TrackingHandler) TrackComplete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !applyTrackingPrincipal(c, &event) {
+		return
+	}
 
 	event.EventType = "complete"
 	event.Timestamp = time.Now().UTC().Format(time.RFC3339)
 	event.IPAddress = c.ClientIP()
 	event.UserAgent = c.GetHeader("User-Agent")
+	metrics.TrackingEvent(event.EventType, metrics.TrackingQueued)
 
 	if err := h.laravelClient.SendTrackingEvent(c.Request.Context(), event); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track event"})
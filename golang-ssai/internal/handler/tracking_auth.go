@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/pkg/urlsign"
+	"github.com/gin-gonic/gin"
+)
+
+// TrackingTokenHeader carries the session token issued with a manifest; players send it
+// back on tracking requests (as this header or an Authorization bearer token)
+const TrackingTokenHeader = "X-Tracking-Token"
+
+// defaultTrackingTokenTTL is how long session tokens are accepted when tracking.token_ttl is unset
+const defaultTrackingTokenTTL = 6 * time.Hour
+
+// trackingPrincipalKey is the gin context key of an authenticated tracking request
+const trackingPrincipalKey = "tracking_principal"
+
+var errInvalidTrackingToken = errors.New("invalid tracking token")
+
+// trackingPrincipal is who a tracking request was authenticated as. Session tokens pin the
+// channel and session as well; tenant API keys only the tenant.
+type trackingPrincipal struct {
+	TenantID  int
+	ChannelID int
+	SessionID string
+}
+
+// mintTrackingToken issues a session token for the viewer of a manifest:
+// tenant.channel.base64(session).expires.hmac
+func mintTrackingToken(cfg config.TrackingConfig, p trackingPrincipal, now time.Time) string {
+	ttl := cfg.TokenTTL
+	if ttl <= 0 {
+		ttl = defaultTrackingTokenTTL
+	}
+
+	fields := []string{
+		strconv.Itoa(p.TenantID),
+		strconv.Itoa(p.ChannelID),
+		base64.RawURLEncoding.EncodeToString([]byte(p.SessionID)),
+		strconv.FormatInt(now.Add(ttl).Unix(), 10),
+	}
+	return strings.Join(fields, ".") + "." + urlsign.Sign(cfg.TokenSecret, fields...)
+}
+
+// parseTrackingToken verifies a session token and returns who it was issued to
+func parseTrackingToken(cfg config.TrackingConfig, token string, now time.Time) (trackingPrincipal, error) {
+	parts := strings.Split(token, ".")
+	if cfg.TokenSecret == "" || len(parts) != 5 {
+		return trackingPrincipal{}, errInvalidTrackingToken
+	}
+
+	want := urlsign.Sign(cfg.TokenSecret, parts[:4]...)
+	if subtle.ConstantTimeCompare([]byte(parts[4]), []byte(want)) != 1 {
+		return trackingPrincipal{}, errInvalidTrackingToken
+	}
+
+	expires, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return trackingPrincipal{}, urlsign.ErrExpired
+	}
+
+	var p trackingPrincipal
+	session, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return trackingPrincipal{}, errInvalidTrackingToken
+	}
+	p.SessionID = string(session)
+	if p.TenantID, err = strconv.Atoi(parts[0]); err != nil {
+		return trackingPrincipal{}, errInvalidTrackingToken
+	}
+	if p.ChannelID, err = strconv.Atoi(parts[1]); err != nil {
+		return trackingPrincipal{}, errInvalidTrackingToken
+	}
+	return p, nil
+}
+
+// TrackingAuth authenticates tracking requests with a session token or a tenant API key
+// (X-API-Key). The tenant of the events is taken from the credentials, never the body.
+func TrackingAuth(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(TrackingTokenHeader)
+		if token == "" {
+			if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+				token = strings.TrimSpace(bearer)
+			}
+		}
+
+		if token != "" {
+			p, err := parseTrackingToken(cfg.Tracking, token, time.Now())
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired tracking token"})
+				return
+			}
+			c.Set(trackingPrincipalKey, p)
+			c.Next()
+			return
+		}
+
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			if tenantID, ok := tenantForAPIKey(cfg.Tracking.APIKeys, key); ok {
+				c.Set(trackingPrincipalKey, trackingPrincipal{TenantID: tenantID})
+				c.Next()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing tracking credentials"})
+	}
+}
+
+// tenantForAPIKey finds the tenant of an API key, comparing every key in constant time
+func tenantForAPIKey(keys map[int]string, key string) (int, bool) {
+	tenantID, found := 0, false
+	for id, k := range keys {
+		if k != "" && subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			tenantID, found = id, true
+		}
+	}
+	return tenantID, found
+}
+
+// trackingPrincipalFrom returns who an authenticated tracking request came from
+func trackingPrincipalFrom(c *gin.Context) (trackingPrincipal, bool) {
+	v, ok := c.Get(trackingPrincipalKey)
+	if !ok {
+		return trackingPrincipal{}, false
+	}
+	p, ok := v.(trackingPrincipal)
+	return p, ok
+}
+
+// applyTrackingPrincipal overrides the tenant (and, for session tokens, channel and
+// session) of an event with the authenticated ones
+func applyTrackingPrincipal(c *gin.Context, event *models.TrackingEvent) bool {
+	p, ok := trackingPrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing tracking credentials"})
+		return false
+	}
+
+	event.TenantID = p.TenantID
+	if p.ChannelID > 0 {
+		event.ChannelID = p.ChannelID
+	}
+	if p.SessionID != "" {
+		event.SessionID = p.SessionID
+	}
+	return true
+}
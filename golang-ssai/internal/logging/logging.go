@@ -0,0 +1,127 @@
+// Package logging builds the service logger (log/slog) and carries request-scoped
+// loggers through contexts
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+)
+
+// Request-scoped field names
+const (
+	KeyRequestID = "request_id"
+	KeyTenant    = "tenant"
+	KeyChannel   = "channel"
+	KeySessionID = "session_id"
+	KeyBreakID   = "break_id"
+	KeyAdID      = "ad_id"
+)
+
+// New creates a JSON (default) or text logger filtered at cfg.Level (info by default)
+func New(cfg config.LoggingConfig, w io.Writer) *slog.Logger {
+	// The wrapping handler does the level filtering, so debug sampling can bypass it
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	var inner slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		inner = slog.NewTextHandler(w, opts)
+	} else {
+		inner = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(&handler{
+		inner: inner,
+		level: parseLevel(cfg.Level),
+		sampler: &sampler{
+			rate:    cfg.DebugSampleRate,
+			tenants: cfg.DebugTenants,
+		},
+	})
+}
+
+func parseLevel(s string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type ctxKey struct{}
+
+// WithLogger returns a context carrying l
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With returns a context whose logger adds the given fields to every record
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// SampleDebug enables debug logs for the rest of the request behind ctx if the
+// tenant's debug sample rate picks it
+func SampleDebug(ctx context.Context, tenant string) context.Context {
+	h, ok := FromContext(ctx).Handler().(*handler)
+	if !ok || h.debug || h.level <= slog.LevelDebug || !h.sampler.sample(tenant) {
+		return ctx
+	}
+
+	sampled := *h
+	sampled.debug = true
+	return WithLogger(ctx, slog.New(&sampled))
+}
+
+// handler filters records by level, letting debug records through for sampled requests
+type handler struct {
+	inner   slog.Handler
+	level   slog.Level
+	debug   bool
+	sampler *sampler
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level || (h.debug && level >= slog.LevelDebug)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *h
+	child.inner = h.inner.WithAttrs(attrs)
+	return &child
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	child := *h
+	child.inner = h.inner.WithGroup(name)
+	return &child
+}
+
+type sampler struct {
+	rate    float64
+	tenants map[string]float64
+}
+
+func (s *sampler) sample(tenant string) bool {
+	rate, ok := s.tenants[tenant]
+	if !ok {
+		rate = s.rate
+	}
+	return rate > 0 && rand.Float64() < rate
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "ssai"
+
+// Latency buckets in seconds, from a cache hit to a slow origin or ad server
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	ManifestRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "manifest_requests_total",
+		Help:      "Manifest requests by HTTP status.",
+	}, []string{"tenant", "channel", "status"})
+
+	ManifestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "manifest_duration_seconds",
+		Help:      "Time to serve a stitched manifest.",
+		Buckets:   latencyBuckets,
+	}, []string{"tenant", "channel"})
+
+	ManifestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "manifests_in_flight",
+		Help:      "Manifest requests being served.",
+	}, []string{"tenant", "channel"})
+
+	OriginFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "origin_fetch_duration_seconds",
+		Help:      "Time to get an origin playlist (cache hits and coalesced fetches included).",
+		Buckets:   latencyBuckets,
+	}, []string{"tenant", "channel"})
+
+	OriginFetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "origin_fetch_errors_total",
+		Help:      "Failed origin playlist fetches.",
+	}, []string{"tenant", "channel"})
+
+	AdDecisionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ad_decision_duration_seconds",
+		Help:      "Time to get an ad decision for a break (cache hits included).",
+		Buckets:   latencyBuckets,
+	}, []string{"tenant", "channel"})
+
+	// Fill rate is filled / (filled + empty + error)
+	AdDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ad_decisions_total",
+		Help:      "Ad decisions by result (filled, empty, error).",
+	}, []string{"tenant", "channel", "result"})
+
+	VASTErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vast_errors_total",
+		Help:      "VAST processing errors by IAB error code.",
+	}, []string{"tenant", "channel", "code"})
+
+	AdBreaksDetected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ad_breaks_detected_total",
+		Help:      "Ad breaks detected by source (scte35, static).",
+	}, []string{"tenant", "channel", "source"})
+
+	AdsStitched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ads_stitched_total",
+		Help:      "Ads stitched into manifests.",
+	}, []string{"tenant", "channel"})
+
+	AdsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ads_dropped_total",
+		Help:      "Ads decided but not stitched, by reason (unresolved, pod_fit).",
+	}, []string{"tenant", "channel", "reason"})
+
+	OriginFailovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "origin_failovers_total",
+		Help:      "Switches of a channel from one origin to another (failovers and failbacks).",
+	}, []string{"tenant", "channel"})
+
+	OriginUnhealthy = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "origin_unhealthy_total",
+		Help:      "Origins marked unhealthy (failed or stale playlists), by origin host.",
+	}, []string{"host"})
+
+	PlaylistIssues = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "playlist_issues_total",
+		Help:      "Origin playlist issues detected (stale, sequence_backwards, target_duration, missing_segments, pdt_gap).",
+	}, []string{"tenant", "channel", "issue"})
+
+	PlaylistIssueActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "playlist_issue_active",
+		Help:      "Whether an origin playlist issue was present on the channel's last poll (1) or not (0).",
+	}, []string{"tenant", "channel", "issue"})
+
+	PlaylistAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "playlist_age_seconds",
+		Help:      "Seconds since the channel's origin playlist last got a new segment, as of its last poll.",
+	}, []string{"tenant", "channel"})
+
+	DegradedResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "degraded_responses_total",
+		Help:      "Manifests served without (fresh) stitching, by reason.",
+	}, []string{"tenant", "channel", "reason"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by rate limiting, by endpoint group and bucket (ip, tenant, session).",
+	}, []string{"scope", "bucket"})
+
+	LaravelRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "laravel_retries_total",
+		Help:      "Laravel requests retried, by endpoint.",
+	}, []string{"endpoint"})
+
+	LaravelCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "laravel_circuit_state",
+		Help:      "Laravel circuit breaker state by endpoint (0 closed, 1 half-open, 2 open).",
+	}, []string{"endpoint"})
+
+	LaravelStaleServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "laravel_stale_served_total",
+		Help:      "Cached channel metadata served while Laravel was unavailable, by endpoint.",
+	}, []string{"endpoint"})
+
+	trackingEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tracking_events_total",
+		Help:      "Tracking events by type and status (queued, sent, failed).",
+	}, []string{"event_type", "status"})
+)
+
+// Ad drop reasons
+const (
+	DropUnresolved = "unresolved" // VAST or ad manifest failed, or missed the stitch deadline
+	DropPodFit     = "pod_fit"    // didn't fit the signaled break
+)
+
+// Tracking event statuses
+const (
+	TrackingQueued = "queued"
+	TrackingSent   = "sent"
+	TrackingFailed = "failed"
+)
+
+// trackingEventTypes are the event types accepted by the Laravel tracking API
+var trackingEventTypes = map[string]bool{
+	"impression": true, "start": true, "first_quartile": true, "midpoint": true,
+	"third_quartile": true, "complete": true, "click": true, "error": true,
+}
+
+// TrackingEvent counts a tracking event; event types sent by players are
+// collapsed to "other" unless known, to keep label cardinality bounded
+func TrackingEvent(eventType, status string) {
+	if !trackingEventTypes[eventType] {
+		eventType = "other"
+	}
+	trackingEvents.WithLabelValues(eventType, status).Inc()
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	httpClientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_client_requests_total",
+		Help:      "Outgoing HTTP requests by client and status code.",
+	}, []string{"client", "code"})
+
+	httpClientInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_client_in_flight_requests",
+		Help:      "Outgoing HTTP requests in flight by client.",
+	}, []string{"client"})
+
+	httpClientConns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_client_connections_total",
+		Help:      "Connections used by outgoing HTTP requests, by client and whether they were reused from the pool.",
+	}, []string{"client", "reused"})
+)
+
+// InstrumentTransport wraps an HTTP transport (nil for http.DefaultTransport) with
+// request, in-flight and connection pool reuse metrics labeled client
+func InstrumentTransport(client string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	inFlight := httpClientInFlight.WithLabelValues(client)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				httpClientConns.WithLabelValues(client, strconv.FormatBool(info.Reused)).Inc()
+			},
+		}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		resp, err := next.RoundTrip(req)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		httpClientRequests.WithLabelValues(client, code).Inc()
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RedisPoolCollector exports the connection pool stats of a Redis client
+type RedisPoolCollector struct {
+	stats func() *redis.PoolStats
+
+	hits, misses, timeouts, total, idle, stale *prometheus.Desc
+}
+
+func NewRedisPoolCollector(stats func() *redis.PoolStats) *RedisPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "redis_pool", name), help, nil, nil)
+	}
+
+	return &RedisPoolCollector{
+		stats:    stats,
+		hits:     desc("hits_total", "Times a free connection was found in the pool."),
+		misses:   desc("misses_total", "Times a free connection was not found in the pool."),
+		timeouts: desc("timeouts_total", "Times a wait for a connection timed out."),
+		total:    desc("connections", "Connections in the pool."),
+		idle:     desc("idle_connections", "Idle connections in the pool."),
+		stale:    desc("stale_connections_total", "Stale connections removed from the pool."),
+	}
+}
+
+func (c *RedisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.total
+	ch <- c.idle
+	ch <- c.stale
+}
+
+func (c *RedisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -75,9 +75,15 @@ type ChannelInfo struct {
 	Name                    string `json:"name"`
 	Slug                    string `json:"slug"`
 	HLSManifestURL          string `json:"hls_manifest_url"`
+	OriginURLs              []string `json:"origin_urls,omitempty"` // ordered primary/backup origins; hls_manifest_url if empty
 	AdBreakStrategy         string `json:"ad_break_strategy"`
 	AdBreakIntervalSeconds  int    `json:"ad_break_interval_seconds"`
 	EnablePreRoll           bool   `json:"enable_pre_roll"`
 	Status                  string `json:"status"`
+	SlateURL                string `json:"slate_url,omitempty"`          // overrides the configured slate
+	EmptyBreakPolicy        string `json:"empty_break_policy,omitempty"` // overrides the configured policy
+	RequireSignedURLs       bool   `json:"require_signed_urls"`
+	URLSigningSecret        string `json:"-"`                            // shared with Laravel, kept in process memory only (never cached or logged)
+	SignedURLBindIP         bool   `json:"signed_url_bind_ip"`           // tokens are bound to the viewer's IP
 }
 
@@ -0,0 +1,34 @@
+package models
+
+// AvailRecord accounts for one ad break as seen by one viewer
+type AvailRecord struct {
+	TenantID         int     `json:"tenant_id"`
+	ChannelID        int     `json:"channel_id"`
+	Tenant           string  `json:"tenant"`
+	Channel          string  `json:"channel"`
+	SessionID        string  `json:"session_id,omitempty"`
+	BreakID          string  `json:"break_id"`
+	Source           string  `json:"source"` // scte35, static
+	Position         string  `json:"position"`
+	DetectedSeconds  float64 `json:"detected_seconds"`  // signaled avail
+	RequestedSeconds float64 `json:"requested_seconds"` // avail an ad decision was requested for
+	FilledSeconds    float64 `json:"filled_seconds"`    // paid ads stitched
+	SlateSeconds     float64 `json:"slate_seconds"`     // slate padding
+	EmptySeconds     float64 `json:"empty_seconds"`     // left to the origin
+	AdIDs            []int   `json:"ad_ids"`
+	Timestamp        string  `json:"timestamp"`
+}
+
+// AvailStats aggregates the avails of a channel over one hour
+type AvailStats struct {
+	Tenant           string  `json:"tenant"`
+	Channel          string  `json:"channel"`
+	Hour             string  `json:"hour"` // RFC3339, UTC
+	Breaks           int64   `json:"breaks"`
+	DetectedSeconds  float64 `json:"detected_seconds"`
+	RequestedSeconds float64 `json:"requested_seconds"`
+	FilledSeconds    float64 `json:"filled_seconds"`
+	SlateSeconds     float64 `json:"slate_seconds"`
+	EmptySeconds     float64 `json:"empty_seconds"`
+	FillRate         float64 `json:"fill_rate"` // filled / requested
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Manifest represents an HLS manifest
 type Manifest struct {
 	Version     int
@@ -18,6 +20,7 @@ type Segment struct {
 	Discontinuity bool
 	ByteRange   string
 	Key         *Key
+	ProgramDateTime *time.Time
 }
 
 // Key represents encryption key info
@@ -34,5 +37,16 @@ type AdBreak struct {
 	Offset      float64 // seconds from start
 	Duration    int    // expected duration in seconds
 	Type        string // scte35, static
+
+	// Avail span in the media playlist (scte35 breaks only): segments [StartIndex, EndIndex)
+	StartIndex int
+	EndIndex   int
+	Elapsed    float64 // seconds of the break that aired before the playlist window
+	// Cue break whose avail span isn't known (an #EXT-X-SCTE35 tag without a break
+	// duration): the pod is inserted at Offset rather than replacing origin segments
+	SpanUnknown bool
+
+	// Schedule slot of a static break (its rule's offset + n*interval), e.g. "mid-roll@120"
+	Slot string
 }
 
@@ -0,0 +1,23 @@
+package models
+
+// PlaylistHealth is the state of a channel's origin playlist as of its last poll
+type PlaylistHealth struct {
+	Tenant         string          `json:"tenant"`
+	Channel        string          `json:"channel"`
+	OriginURL      string          `json:"origin_url"`
+	MediaSequence  int64           `json:"media_sequence"`
+	Segments       int             `json:"segments"`
+	TargetDuration float64         `json:"target_duration"`
+	EndList        bool            `json:"end_list"`
+	LastAdvancedAt string          `json:"last_advanced_at"` // RFC3339, last time a new segment appeared
+	CheckedAt      string          `json:"checked_at"`       // RFC3339
+	Healthy        bool            `json:"healthy"`
+	Issues         []PlaylistIssue `json:"issues"`
+}
+
+// PlaylistIssue is a problem found in an origin playlist
+type PlaylistIssue struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Since  string `json:"since"` // RFC3339, first poll it was found on
+}
@@ -1,10 +1,12 @@
 package parser
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
 	"github.com/fast-ads-backend/golang-ssai/internal/models"
 	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
 )
@@ -34,10 +36,11 @@ func (p *M3U8Parser) Parse(manifest string) (*models.Manifest, error) {
 
 	for _, seg := range hlsManifest.Segments {
 		m.Segments = append(m.Segments, models.Segment{
-			URI:           seg.URI,
-			Duration:      seg.Duration,
-			Title:         seg.Title,
-			Discontinuity: seg.Discontinuity,
+			URI:             seg.URI,
+			Duration:        seg.Duration,
+			Title:           seg.Title,
+			Discontinuity:   seg.Discontinuity,
+			ProgramDateTime: seg.ProgramDateTime,
 		})
 	}
 
@@ -99,13 +102,11 @@ func (p *M3U8Parser) StitchAds(manifest string, ads []models.Ad, breakPoint floa
 
 // StitchMultipleAdBreaks stitches multiple ad breaks into manifest
 // This is more efficient than calling StitchAds multiple times
-func (p *M3U8Parser) StitchMultipleAdBreaks(manifest string, adBreaks []AdBreakWithAds) (string, error) {
-	fmt.Printf("DEBUG: StitchMultipleAdBreaks called with %d ad breaks\n", len(adBreaks))
+func (p *M3U8Parser) StitchMultipleAdBreaks(ctx context.Context, manifest string, adBreaks []AdBreakWithAds) (string, error) {
 	hlsManifest, err := hls.ParseManifest(manifest)
 	if err != nil {
 		return manifest, fmt.Errorf("failed to parse manifest: %w", err)
 	}
-	fmt.Printf("DEBUG: Parsed manifest - %d segments before stitching\n", len(hlsManifest.Segments))
 
 	// Sort ad breaks by offset (ascending)
 	sort.Slice(adBreaks, func(i, j int) bool {
@@ -117,37 +118,20 @@ func (p *M3U8Parser) StitchMultipleAdBreaks(manifest string, adBreaks []AdBreakW
 	for _, seg := range hlsManifest.Segments {
 		totalDuration += seg.Duration
 	}
-	fmt.Printf("DEBUG: Manifest total duration: %.2f seconds, %d segments\n", totalDuration, len(hlsManifest.Segments))
 	
 	// Process ad breaks in reverse order to maintain correct indices
 	// We need to insert from end to beginning to avoid index shifting issues
 	for i := len(adBreaks) - 1; i >= 0; i-- {
 		adBreak := adBreaks[i]
-		
-		fmt.Printf("DEBUG: Processing ad break: offset=%.2f\n", adBreak.Offset)
-		
+		log := logging.FromContext(ctx).With(logging.KeyBreakID, adBreak.ID, "offset", adBreak.Offset)
+
 		// Skip ad breaks that are beyond the manifest duration
 		// For LIVE streams, we should only insert ads within the current manifest window
 		if adBreak.Offset > totalDuration {
-			fmt.Printf("DEBUG: Skipping ad break at offset %.2f (beyond manifest duration %.2f)\n", 
-				adBreak.Offset, totalDuration)
+			log.Debug("Skipping ad break beyond the manifest duration", "manifest_duration", totalDuration)
 			continue
 		}
 		
-		// Special handling for pre-roll (offset = 0)
-		// Pre-roll must be inserted BEFORE the first segment (at index 0)
-		var insertIndex int
-		if adBreak.Offset == 0 {
-			// Pre-roll: always insert at index 0 (before first segment)
-			insertIndex = 0
-		} else {
-			insertIndex = p.findInsertionPoint(hlsManifest, adBreak.Offset)
-			if insertIndex < 0 {
-				fmt.Printf("DEBUG: Skipping ad break at offset %.2f (invalid insertion point)\n", adBreak.Offset)
-				continue // Skip invalid insertion points
-			}
-		}
-
 		// Convert ads to ad segments
 		// Note: ad.VASTURL now contains the ad manifest content (not URL) with rewritten absolute URLs
 		adSegments := make([]hls.AdSegment, 0, len(adBreak.Ads))
@@ -155,46 +139,114 @@ func (p *M3U8Parser) StitchMultipleAdBreaks(manifest string, adBreaks []AdBreakW
 			// ad.VASTURL contains the ad manifest content with absolute URLs
 			// Parse it and extract segments
 			// ad.VASTURL now contains the rewritten ad manifest with absolute URLs
-			fmt.Printf("DEBUG: Parsing ad manifest for ad %d (length: %d chars)\n", ad.AdID, len(ad.VASTURL))
 			adManifest, err := hls.ParseManifest(ad.VASTURL)
 			if err != nil {
-				fmt.Printf("ERROR: Failed to parse ad manifest for ad %d: %v\n", ad.AdID, err)
+				log.Error("Failed to parse ad manifest", logging.KeyAdID, ad.AdID, "error", err)
 				continue
 			}
-			
-			fmt.Printf("DEBUG: Ad %d manifest parsed - %d segments found\n", ad.AdID, len(adManifest.Segments))
-			
+
 			// Add each segment from ad manifest as a separate ad segment
 			for i, seg := range adManifest.Segments {
-				fmt.Printf("DEBUG: Ad %d segment %d: URI=%s, Duration=%.2f\n", ad.AdID, i, seg.URI, seg.Duration)
 				adSegments = append(adSegments, hls.AdSegment{
-					URI:      seg.URI,
-					Duration: seg.Duration,
-					Title:    fmt.Sprintf("Ad %d", ad.AdID),
+					URI:           seg.URI,
+					Duration:      seg.Duration,
+					Title:         fmt.Sprintf("Ad %d", ad.AdID),
+					Discontinuity: i == 0, // Each creative has its own timestamps
 				})
 			}
 		}
 
+		// Pad underfilled pods with the channel's slate up to the signaled break duration
+		if adBreak.Slate != "" && adBreak.Duration > 0 {
+			slateManifest, err := hls.ParseManifest(adBreak.Slate)
+			if err != nil {
+				log.Error("Failed to parse slate manifest", "error", err)
+			} else {
+				before := len(adSegments)
+				adSegments = hls.PadWithSlate(adSegments, slateManifest.Segments, adBreak.Duration)
+				if added := len(adSegments) - before; added > 0 {
+					log.Debug("Padded ad break with slate", "slate_segments", added, "break_duration", adBreak.Duration)
+				}
+			}
+		}
+
+		if len(adSegments) == 0 {
+			log.Debug("Skipping ad break without ad or slate segments")
+			continue
+		}
+
+		// Cue-driven breaks: the pod replaces the origin segments inside the signaled avail
+		if adBreak.Replace {
+			if adBreak.EndIndex <= adBreak.StartIndex {
+				log.Debug("Skipping ad break with no avail segments in the window yet")
+				continue
+			}
+			if adBreak.StartIndex < 0 || adBreak.EndIndex > len(hlsManifest.Segments) {
+				log.Error("Avail span out of range", "start", adBreak.StartIndex, "end", adBreak.EndIndex, "segments", len(hlsManifest.Segments))
+				continue
+			}
+
+			var availDuration float64
+			for _, seg := range hlsManifest.Segments[adBreak.StartIndex:adBreak.EndIndex] {
+				availDuration += seg.Duration
+			}
+
+			// Only the part of the pod that lines up with the avail in this window is played;
+			// a break already in progress resumes the pod at its elapsed time
+			podSegments := hls.ClipAdSegments(adSegments, adBreak.Elapsed, availDuration)
+			if len(podSegments) == 0 {
+				log.Debug("Pod already finished, keeping origin segments")
+				continue
+			}
+			log.Debug("Replacing origin segments", "start", adBreak.StartIndex, "end", adBreak.EndIndex,
+				"avail_duration", availDuration, "elapsed", adBreak.Elapsed, "ad_segments", len(podSegments))
+			if err := hls.ReplaceSegments(hlsManifest, adBreak.StartIndex, adBreak.EndIndex, podSegments); err != nil {
+				log.Error("Failed to replace segments", "start", adBreak.StartIndex, "end", adBreak.EndIndex, "error", err)
+			}
+			continue
+		}
+
+		// Static breaks: insert the pod after the segment at the break offset
+		// Special handling for pre-roll (offset = 0)
+		// Pre-roll must be inserted BEFORE the first segment (at index 0)
+		var insertIndex int
+		if adBreak.Offset == 0 {
+			// Pre-roll: always insert at index 0 (before first segment)
+			insertIndex = 0
+		} else {
+			insertIndex = p.findInsertionPoint(hlsManifest, adBreak.Offset)
+			if insertIndex < 0 {
+				log.Debug("Skipping ad break with an invalid insertion point")
+				continue // Skip invalid insertion points
+			}
+		}
+
 		// Insert ad segments
-		fmt.Printf("DEBUG: Inserting %d ad segments at index %d\n", len(adSegments), insertIndex)
+		log.Debug("Inserting ad segments", "ad_segments", len(adSegments), "index", insertIndex)
 		if err := hls.InsertAdSegments(hlsManifest, adSegments, insertIndex); err != nil {
-			fmt.Printf("ERROR: Failed to insert ad segments at index %d: %v\n", insertIndex, err)
+			log.Error("Failed to insert ad segments", "index", insertIndex, "error", err)
 			// Log error but continue with other breaks
 			continue
 		}
-		fmt.Printf("DEBUG: Successfully inserted ad segments. Manifest now has %d segments\n", len(hlsManifest.Segments))
 	}
 
 	// Render back to M3U8
-	rendered := hls.RenderManifest(hlsManifest)
-	fmt.Printf("DEBUG: Rendered manifest - %d bytes\n", len(rendered))
-	return rendered, nil
+	return hls.RenderManifest(hlsManifest), nil
 }
 
 // AdBreakWithAds represents an ad break with its associated ads
 type AdBreakWithAds struct {
-	Offset float64
-	Ads    []models.Ad
+	ID       string
+	Offset   float64
+	Duration float64 // signaled break duration in seconds (0 if unknown)
+	Ads      []models.Ad
+	Slate    string // slate media playlist content used to pad the pod to Duration (optional)
+	Replace  bool   // replace the origin segments in [StartIndex, EndIndex) instead of inserting
+
+	// Avail span in the media playlist (cue-driven breaks only)
+	StartIndex int
+	EndIndex   int
+	Elapsed    float64 // seconds of the break that aired before the playlist window
 }
 
 // findInsertionPoint finds the segment index where to insert ads based on cumulative duration
@@ -1,11 +1,19 @@
 package parser
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/creative"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
+	"github.com/fast-ads-backend/golang-ssai/pkg/urlrewrite"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // VAST represents the root VAST element
@@ -42,8 +50,15 @@ type Creatives struct {
 
 // Creative represents a creative element
 type Creative struct {
-	ID     string `xml:"id,attr"`
-	Linear *Linear `xml:"Linear"`
+	ID            string         `xml:"id,attr"`
+	UniversalAdID *UniversalAdID `xml:"UniversalAdId"` // VAST 4.x
+	Linear        *Linear        `xml:"Linear"`
+}
+
+// UniversalAdID identifies a creative across ad servers (e.g. an Ad-ID code)
+type UniversalAdID struct {
+	IDRegistry string `xml:"idRegistry,attr"`
+	Value      string `xml:",chardata"`
 }
 
 // Linear represents linear ad
@@ -87,51 +102,108 @@ type VideoClicks struct {
 	ClickTracking string `xml:"ClickTracking"`
 }
 
+// vastFetchTimeout bounds each ad server request (wrapper hops are fetched separately)
+const vastFetchTimeout = 10 * time.Second
+
 // VASTParser handles VAST XML parsing
-type VASTParser struct{}
+type VASTParser struct {
+	content *cache.ContentCache // nil disables VAST caching
+	ttl     time.Duration
+	client  *http.Client
+}
 
-// NewVASTParser creates a new VAST parser
-func NewVASTParser() *VASTParser {
-	return &VASTParser{}
+// NewVASTParser creates a new VAST parser.
+// VAST responses are cached in content for up to ttl (less if their Cache-Control says so).
+func NewVASTParser(content *cache.ContentCache, ttl time.Duration) *VASTParser {
+	return &VASTParser{
+		content: content,
+		ttl:     ttl,
+		client: &http.Client{
+			Timeout:   vastFetchTimeout,
+			Transport: tracing.Transport(nil),
+		},
+	}
 }
 
 // FetchVAST fetches VAST XML from URL
-func (p *VASTParser) FetchVAST(vastURL string) (string, error) {
-	resp, err := http.Get(vastURL)
+func (p *VASTParser) FetchVAST(ctx context.Context, vastURL string) (string, error) {
+	// Ad server URLs (and wrapper hops) are mapped by the tenant's host rewrite rules
+	vastURL = urlrewrite.FromContext(ctx).Apply(vastURL)
+	ctx, span := tracing.Start(ctx, "vast.fetch", attribute.String("vast.url", vastURL))
+	body, err := p.fetchCachedVAST(ctx, vastURL)
+	tracing.End(span, err)
+	return body, err
+}
+
+func (p *VASTParser) fetchCachedVAST(ctx context.Context, vastURL string) (string, error) {
+	if p.content == nil || p.ttl <= 0 {
+		body, _, err := p.fetchVAST(ctx, vastURL)
+		return body, err
+	}
+
+	return p.content.Get(ctx, vastURL, func(ctx context.Context) (string, time.Duration, error) {
+		body, header, err := p.fetchVAST(ctx, vastURL)
+		if err != nil {
+			return "", 0, err
+		}
+		return body, cache.CacheControlTTL(header.Get("Cache-Control"), p.ttl), nil
+	})
+}
+
+func (p *VASTParser) fetchVAST(ctx context.Context, vastURL string) (string, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", vastURL, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create VAST request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch VAST: %w", err)
+		return "", nil, fmt.Errorf("failed to fetch VAST: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("VAST fetch failed with status: %d", resp.StatusCode)
+		return "", nil, fmt.Errorf("VAST fetch failed with status: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read VAST response: %w", err)
+		return "", nil, fmt.Errorf("failed to read VAST response: %w", err)
 	}
 
-	return string(body), nil
+	return string(body), resp.Header, nil
 }
 
 // ParseVAST parses VAST XML string
-func (p *VASTParser) ParseVAST(vastXML string) (*VAST, error) {
+func (p *VASTParser) ParseVAST(ctx context.Context, vastXML string) (*VAST, error) {
+	return p.parseVAST(ctx, vastXML, 0)
+}
+
+func (p *VASTParser) parseVAST(ctx context.Context, vastXML string, depth int) (*VAST, error) {
 	var vast VAST
 	err := xml.Unmarshal([]byte(vastXML), &vast)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse VAST XML: %w", err)
+		return nil, vastError(VASTErrorXMLParse, fmt.Errorf("failed to parse VAST XML: %w", err))
 	}
 
 	// Handle VAST wrapper (redirect)
 	if vast.Ad.Wrapper != nil && vast.Ad.Wrapper.VASTAdTagURI != "" {
-		// Fetch wrapped VAST
-		wrappedVAST, err := p.FetchVAST(strings.TrimSpace(vast.Ad.Wrapper.VASTAdTagURI))
+		if depth >= maxWrapperDepth {
+			return nil, vastError(VASTErrorWrapperLimit, fmt.Errorf("VAST wrapper limit of %d reached", maxWrapperDepth))
+		}
+		// Fetch wrapped VAST (one span per wrapper hop)
+		hopCtx, span := tracing.Start(ctx, "vast.wrapper", attribute.Int("vast.wrapper_depth", depth+1))
+		wrappedVAST, err := p.FetchVAST(hopCtx, strings.TrimSpace(vast.Ad.Wrapper.VASTAdTagURI))
+		tracing.End(span, err)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch wrapped VAST: %w", err)
+			return nil, vastError(fetchErrorCode(err), fmt.Errorf("failed to fetch wrapped VAST: %w", err))
 		}
 		// Parse wrapped VAST recursively
-		return p.ParseVAST(wrappedVAST)
+		return p.parseVAST(ctx, wrappedVAST, depth+1)
+	}
+
+	if vast.Ad.InLine == nil {
+		return nil, vastError(VASTErrorNoAds, fmt.Errorf("no ad in VAST response"))
 	}
 
 	return &vast, nil
@@ -241,6 +313,33 @@ func (p *VASTParser) ExtractTrackingURLs(vast *VAST) map[string]string {
 	return trackingURLs
 }
 
+// ExtractUniversalAdID extracts the UniversalAdId of the first creative that has one.
+// Returned as "registry:value" so IDs from different registries never collide.
+func (p *VASTParser) ExtractUniversalAdID(vast *VAST) string {
+	if vast.Ad.InLine == nil {
+		return ""
+	}
+
+	for _, creative := range vast.Ad.InLine.Creatives.Creative {
+		if creative.UniversalAdID == nil {
+			continue
+		}
+
+		value := strings.TrimSpace(creative.UniversalAdID.Value)
+		if value == "" || strings.EqualFold(value, "unknown") {
+			continue
+		}
+
+		registry := strings.TrimSpace(creative.UniversalAdID.IDRegistry)
+		if registry == "" || strings.EqualFold(registry, "unknown") {
+			return value
+		}
+		return registry + ":" + value
+	}
+
+	return ""
+}
+
 // ExtractClickThroughURL extracts click-through URL from VAST
 func (p *VASTParser) ExtractClickThroughURL(vast *VAST) string {
 	if vast.Ad.InLine == nil {
@@ -262,15 +361,25 @@ func (p *VASTParser) ExtractClickThroughURL(vast *VAST) string {
 }
 
 // ProcessVAST processes VAST URL and extracts all relevant information
-func (p *VASTParser) ProcessVAST(vastURL string) (*VASTInfo, error) {
+func (p *VASTParser) ProcessVAST(ctx context.Context, vastURL string) (*VASTInfo, error) {
+	ctx, span := tracing.Start(ctx, "vast.process")
+	info, err := p.processVAST(ctx, vastURL)
+	if err != nil {
+		span.SetAttributes(attribute.Int("vast.error_code", VASTErrorCode(err)))
+	}
+	tracing.End(span, err)
+	return info, err
+}
+
+func (p *VASTParser) processVAST(ctx context.Context, vastURL string) (*VASTInfo, error) {
 	// Fetch VAST XML
-	vastXML, err := p.FetchVAST(vastURL)
+	vastXML, err := p.FetchVAST(ctx, vastURL)
 	if err != nil {
-		return nil, err
+		return nil, vastError(fetchErrorCode(err), err)
 	}
 
 	// Parse VAST
-	vast, err := p.ParseVAST(vastXML)
+	vast, err := p.ParseVAST(ctx, vastXML)
 	if err != nil {
 		return nil, err
 	}
@@ -282,6 +391,7 @@ func (p *VASTParser) ProcessVAST(vastURL string) (*VASTInfo, error) {
 		VideoURLs:     p.ExtractVideoURLs(vast),
 		TrackingURLs:  p.ExtractTrackingURLs(vast),
 		ClickThroughURL: p.ExtractClickThroughURL(vast),
+		UniversalAdID:   p.ExtractUniversalAdID(vast),
 	}
 
 	// Try to get HLS manifest URL
@@ -304,5 +414,21 @@ type VASTInfo struct {
 	VideoURLs       []string          // All video URLs found
 	TrackingURLs    map[string]string // Event -> URL mapping
 	ClickThroughURL string            // Click-through URL
+	UniversalAdID   string            // UniversalAdId (registry:value), if present
+}
+
+// CreativeKey returns the creative registry key of the ad's media
+func (v *VASTInfo) CreativeKey() string {
+	mediaURL := v.MP4URL
+	if mediaURL == "" {
+		mediaURL = v.HLSManifestURL
+	}
+	return creative.Key(v.UniversalAdID, mediaURL)
+}
+
+// LookupCreative looks up the ad's creative in the registry for a profile.
+// Returns nil if the creative hasn't been seen for this profile yet.
+func (v *VASTInfo) LookupCreative(ctx context.Context, registry *creative.Registry, profile creative.Profile) (*creative.Entry, error) {
+	return registry.Get(ctx, v.CreativeKey(), creative.ProfileID(profile))
 }
 
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// IAB VAST error codes reported for failed ads
+const (
+	VASTErrorXMLParse       = 100 // XML parsing error
+	VASTErrorWrapper        = 300 // general wrapper error
+	VASTErrorWrapperTimeout = 301 // timeout of the VAST URI
+	VASTErrorWrapperLimit   = 302 // wrapper limit reached
+	VASTErrorNoAds          = 303 // no ads in the VAST response
+	VASTErrorMediaFile      = 403 // couldn't find a supported media file
+	VASTErrorUndefined      = 900 // undefined error
+)
+
+// maxWrapperDepth is how many wrappers are followed before giving up
+const maxWrapperDepth = 5
+
+// VASTError is a VAST processing error with its IAB error code
+type VASTError struct {
+	Code int
+	Err  error
+}
+
+func (e *VASTError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *VASTError) Unwrap() error {
+	return e.Err
+}
+
+func vastError(code int, err error) error {
+	var ve *VASTError
+	if errors.As(err, &ve) {
+		return err // keep the innermost (most specific) code
+	}
+	return &VASTError{Code: code, Err: err}
+}
+
+// fetchErrorCode classifies a failed VAST fetch
+func fetchErrorCode(err error) int {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return VASTErrorWrapperTimeout
+	}
+	return VASTErrorWrapper
+}
+
+// VASTErrorCode returns the IAB error code of a VAST processing error
+func VASTErrorCode(err error) int {
+	var ve *VASTError
+	if errors.As(err, &ve) {
+		return ve.Code
+	}
+	return VASTErrorUndefined
+}
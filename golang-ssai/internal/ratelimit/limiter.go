@@ -0,0 +1,59 @@
+// Package ratelimit implements token bucket rate limiting, in memory or in Redis
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Limiter backends
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Limit is a token bucket: Rate tokens per second, holding at most Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// LimitFrom converts a configured limit; ok is false if the limit is disabled
+func LimitFrom(l config.RateLimit) (Limit, bool) {
+	if l.RequestsPerMinute <= 0 {
+		return Limit{}, false
+	}
+	burst := l.Burst
+	if burst <= 0 {
+		burst = l.RequestsPerMinute
+	}
+	return Limit{Rate: float64(l.RequestsPerMinute) / 60, Burst: burst}, true
+}
+
+// Result of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+// Limiter takes one token from the bucket at key
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// New creates the limiter selected by rate_limiting.backend. The redis backend shares
+// the Redis connection of c; it falls back to memory if c isn't backed by Redis.
+func New(cfg config.RateLimitingConfig, c cache.Cache) Limiter {
+	if cfg.Backend == BackendRedis {
+		if rc, ok := c.(interface{ Client() redis.UniversalClient }); ok && rc.Client() != nil {
+			return NewRedisLimiter(rc.Client())
+		}
+		slog.Warn("Rate limiting backend is redis but the cache isn't backed by Redis, limiting per instance")
+	}
+	return NewMemoryLimiter()
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/client"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"golang.org/x/sync/singleflight"
+)
+
+// cachedDecision is the cache envelope of an ad decision
+type cachedDecision struct {
+	Response  *models.AdDecisionResponse `json:"response"`
+	ExpiresAt time.Time                  `json:"expires_at"`
+}
+
+type prefetchJob struct {
+	key string
+	req models.AdDecisionRequest
+}
+
+// AdDecisionService caches ad decisions per break and audience, coalesces
+// concurrent requests for the same decision, and prefetches decisions in the
+// background so the manifest path rarely waits on the ad server
+type AdDecisionService struct {
+	laravelClient *client.LaravelClient
+	cache         cache.Cache
+	ttl           time.Duration
+	refreshAhead  time.Duration
+	group         singleflight.Group
+	prefetch      chan prefetchJob
+}
+
+// NewAdDecisionService creates the decision service and starts its prefetch workers.
+// Cached decisions are refreshed in the background once they are within refreshAhead of expiring.
+func NewAdDecisionService(laravelClient *client.LaravelClient, c cache.Cache, ttl, refreshAhead time.Duration, workers int) *AdDecisionService {
+	if workers <= 0 {
+		workers = 4
+	}
+
+	s := &AdDecisionService{
+		laravelClient: laravelClient,
+		cache:         c,
+		ttl:           ttl,
+		refreshAhead:  refreshAhead,
+		prefetch:      make(chan prefetchJob, workers*64),
+	}
+
+	for i := 0; i < workers; i++ {
+		go s.prefetchWorker()
+	}
+
+	return s
+}
+
+// DecisionKey returns the cache key of a decision for a break and audience
+func DecisionKey(tenant, channel, breakKey, audience string) string {
+	return fmt.Sprintf("ad_decision:%s:%s:%s:%s", tenant, channel, breakKey, audience)
+}
+
+// AudienceSegment groups viewers that may share a decision: per session when the
+// player sends one, otherwise per country and device class
+func AudienceSegment(sessionID, geo, userAgent string) string {
+	if sessionID != "" {
+		return "session:" + sessionID
+	}
+	if geo == "" {
+		geo = "xx"
+	}
+	return fmt.Sprintf("geo:%s|device:%s", strings.ToLower(geo), DeviceClass(userAgent))
+}
+
+// DeviceClass buckets a user agent into a coarse device class
+func DeviceClass(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return "unknown"
+	case strings.Contains(ua, "smart-tv") || strings.Contains(ua, "smarttv") || strings.Contains(ua, "appletv") ||
+		strings.Contains(ua, "roku") || strings.Contains(ua, "aft") || strings.Contains(ua, "tizen") ||
+		strings.Contains(ua, "webos") || strings.Contains(ua, "bravia") || strings.Contains(ua, "android tv"):
+		return "ctv"
+	case strings.Contains(ua, "mobile") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") ||
+		strings.Contains(ua, "android"):
+		return "mobile"
+	default:
+		return "desktop"
+	}
+}
+
+// GetDecision returns the cached decision for key, or asks Laravel for one.
+// Concurrent callers for the same key share a single Laravel request.
+func (s *AdDecisionService) GetDecision(ctx context.Context, key string, req models.AdDecisionRequest) (*models.AdDecisionResponse, error) {
+	if cached, ok := s.getCached(ctx, key); ok {
+		// Refresh-ahead: renew decisions about to expire so the next break hits the cache
+		if s.refreshAhead > 0 && time.Until(cached.ExpiresAt) < s.refreshAhead {
+			s.Prefetch(key, req)
+		}
+		logging.FromContext(ctx).Debug("Ad decision cache hit", "key", key)
+		return cached.Response, nil
+	}
+
+	// Detach from the caller's cancellation: other requests may be waiting on this flight
+	flightCtx := context.WithoutCancel(ctx)
+	v, err, shared := s.group.Do(key, func() (interface{}, error) {
+		return s.fetch(flightCtx, key, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		logging.FromContext(ctx).Debug("Ad decision coalesced", "key", key)
+	}
+
+	return v.(*models.AdDecisionResponse), nil
+}
+
+// Prefetch requests a decision in the background unless one is cached and fresh.
+// Never blocks; prefetches are dropped when the queue is full.
+func (s *AdDecisionService) Prefetch(key string, req models.AdDecisionRequest) {
+	select {
+	case s.prefetch <- prefetchJob{key: key, req: req}:
+	default:
+		slog.Warn("Ad decision prefetch queue full, dropping", "key", key)
+	}
+}
+
+func (s *AdDecisionService) prefetchWorker() {
+	for job := range s.prefetch {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+		cached, ok := s.getCached(ctx, job.key)
+		if !ok || time.Until(cached.ExpiresAt) < s.refreshAhead {
+			_, err, _ := s.group.Do(job.key, func() (interface{}, error) {
+				return s.fetch(ctx, job.key, job.req)
+			})
+			if err != nil {
+				slog.Error("Ad decision prefetch failed", "key", job.key, "error", err)
+			} else {
+				slog.Debug("Ad decision prefetched", "key", job.key)
+			}
+		}
+
+		cancel()
+	}
+}
+
+// fetch calls Laravel and caches the decision (empty decisions included, errors excluded)
+func (s *AdDecisionService) fetch(ctx context.Context, key string, req models.AdDecisionRequest) (*models.AdDecisionResponse, error) {
+	resp, err := s.laravelClient.GetAdDecision(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Success && s.ttl > 0 {
+		data, err := json.Marshal(cachedDecision{
+			Response:  resp,
+			ExpiresAt: time.Now().Add(s.ttl),
+		})
+		if err == nil {
+			if err := s.cache.Set(ctx, key, string(data), s.ttl); err != nil {
+				logging.FromContext(ctx).Warn("Failed to cache ad decision", "key", key, "error", err)
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *AdDecisionService) getCached(ctx context.Context, key string) (*cachedDecision, bool) {
+	if s.ttl <= 0 {
+		return nil, false
+	}
+
+	raw, err := s.cache.Get(ctx, key)
+	if err != nil || raw == "" {
+		return nil, false
+	}
+
+	var cached cachedDecision
+	if err := json.Unmarshal([]byte(raw), &cached); err != nil || cached.Response == nil {
+		return nil, false
+	}
+
+	return &cached, true
+}
@@ -1,11 +1,15 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
 	"github.com/fast-ads-backend/golang-ssai/internal/models"
 	"github.com/fast-ads-backend/golang-ssai/pkg/scte35"
 )
@@ -19,18 +23,21 @@ func NewAdBreakDetector() *AdBreakDetector {
 
 // DetectAdBreaks detects all ad breaks in a manifest
 // Priority: SCTE-35 > Static Rules > Default Rules
-func (d *AdBreakDetector) DetectAdBreaks(manifest *models.Manifest, manifestText string, staticRules []StaticAdRule) []models.AdBreak {
+// manifestText must be the media playlist manifest was parsed from, so cue spans
+// line up with manifest.Segments.
+func (d *AdBreakDetector) DetectAdBreaks(ctx context.Context, manifest *models.Manifest, manifestText string, staticRules []StaticAdRule) []models.AdBreak {
 	adBreaks := []models.AdBreak{}
 
 	// 1. Try SCTE-35 detection first
-	scte35Breaks := d.detectSCTE35(manifestText)
+	scte35Breaks := d.detectSCTE35(manifest, manifestText)
 	if len(scte35Breaks) > 0 {
 		adBreaks = append(adBreaks, scte35Breaks...)
 	}
 
-	// 2. Apply static rules if no SCTE-35 found or as fallback
-	if len(adBreaks) == 0 || len(staticRules) > 0 {
-		staticBreaks := d.detectStaticRules(manifest, staticRules)
+	// 2. Static rules only apply to origins without cues - inserting static breaks
+	// into a cue-driven window would play ads over content around the signaled avail
+	if len(adBreaks) == 0 && len(staticRules) > 0 {
+		staticBreaks := d.detectStaticRules(ctx, manifest, staticRules)
 		adBreaks = append(adBreaks, staticBreaks...)
 	}
 
@@ -40,79 +47,201 @@ func (d *AdBreakDetector) DetectAdBreaks(manifest *models.Manifest, manifestText
 	return adBreaks
 }
 
+var cueDurationRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)`)
+
 // detectSCTE35 detects SCTE-35 cues in manifest
-func (d *AdBreakDetector) detectSCTE35(manifestText string) []models.AdBreak {
+// Each CUE-OUT/CUE-IN pair becomes a break spanning the segments between them.
+// A CUE-OUT without CUE-IN (break still airing) spans to the end of the window, and
+// a window starting with CUE-OUT-CONT yields a break with the already-aired time in Elapsed.
+func (d *AdBreakDetector) detectSCTE35(manifest *models.Manifest, manifestText string) []models.AdBreak {
 	adBreaks := []models.AdBreak{}
 	lines := strings.Split(manifestText, "\n")
 
-	var currentOffset float64
-	var cueOutFound bool
-	var cueOutOffset float64
-	var cueDuration int
+	var currentOffset, segmentDuration float64
+	var segmentIndex int
+	var open *models.AdBreak
+	var pdt, openPDT time.Time // PROGRAM-DATE-TIME of the next segment and of the open break's start
 
-	for i, line := range lines {
+	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
-		// Check for #EXT-X-CUE-OUT
-		if strings.Contains(line, "#EXT-X-CUE-OUT") {
-			cueOutFound = true
-			cueOutOffset = currentOffset
-
-			// Try to extract duration from tag
-			// Format: #EXT-X-CUE-OUT:30 or #EXT-X-CUE-OUT-CONT:30/30
-			durationRegex := regexp.MustCompile(`(\d+)`)
-			matches := durationRegex.FindStringSubmatch(line)
-			if len(matches) > 0 {
-				if dur, err := strconv.Atoi(matches[1]); err == nil {
-					cueDuration = dur
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-CUE-OUT-CONT"):
+			// Window starts in the middle of a break
+			if open == nil {
+				elapsed, duration := parseCueOutCont(line)
+				open = &models.AdBreak{
+					Position:   "mid-roll",
+					Offset:     currentOffset,
+					Duration:   int(duration + 0.5),
+					Type:       "scte35",
+					StartIndex: segmentIndex,
+					Elapsed:    elapsed,
+				}
+				openPDT = time.Time{}
+				if !pdt.IsZero() {
+					openPDT = pdt.Add(-time.Duration(elapsed * float64(time.Second)))
 				}
 			}
-		}
 
-		// Check for #EXT-X-CUE-IN
-		if strings.Contains(line, "#EXT-X-CUE-IN") && cueOutFound {
-			adBreaks = append(adBreaks, models.AdBreak{
-				ID:       fmt.Sprintf("scte35_%d", i),
-				Position: "mid-roll",
-				Offset:   cueOutOffset,
-				Duration: cueDuration,
-				Type:     "scte35",
-			})
-			cueOutFound = false
-			cueDuration = 0
-		}
+		// Format: #EXT-X-CUE-OUT:30 or #EXT-X-CUE-OUT:DURATION=30
+		case strings.HasPrefix(line, "#EXT-X-CUE-OUT"):
+			var duration float64
+			if matches := cueDurationRegex.FindStringSubmatch(line); len(matches) > 1 {
+				duration, _ = strconv.ParseFloat(matches[1], 64)
+			}
+			open = &models.AdBreak{
+				Position:   "mid-roll",
+				Offset:     currentOffset,
+				Duration:   int(duration + 0.5),
+				Type:       "scte35",
+				StartIndex: segmentIndex,
+			}
+			openPDT = pdt
+
+		case strings.HasPrefix(line, "#EXT-X-CUE-IN"):
+			if open != nil {
+				open.EndIndex = segmentIndex
+				adBreaks = append(adBreaks, d.finishCueBreak(manifest, open, openPDT))
+				open = nil
+			}
 
-		// Check for #EXT-X-SCTE35 tag
-		if strings.HasPrefix(line, "#EXT-X-SCTE35:") {
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")); err == nil {
+				pdt = t
+			}
+
+		case strings.HasPrefix(line, "#EXT-X-SCTE35:"):
 			scte35Data := strings.TrimPrefix(line, "#EXT-X-SCTE35:")
 			cue, err := scte35.ParseSCTE35(scte35Data)
 			if err == nil && cue != nil {
-				adBreaks = append(adBreaks, models.AdBreak{
-					ID:       fmt.Sprintf("scte35_%d", i),
-					Position: "mid-roll",
-					Offset:   currentOffset,
-					Duration: cue.BreakDuration,
-					Type:     "scte35",
-				})
+				adBreak := models.AdBreak{
+					ID:         fmt.Sprintf("scte35_%d", manifest.MediaSequence+int64(segmentIndex)),
+					Position:   "mid-roll",
+					Offset:     currentOffset,
+					Duration:   cue.BreakDuration,
+					Type:       "scte35",
+					StartIndex: segmentIndex,
+					EndIndex:   segmentIndex,
+				}
+				if cue.BreakDuration > 0 {
+					// The avail is the segments covering the splice's break duration
+					adBreak.EndIndex = cueSpanEnd(manifest, segmentIndex, float64(cue.BreakDuration))
+				} else {
+					// Without a duration the avail can't be found: insert the pod instead
+					adBreak.SpanUnknown = true
+				}
+				adBreaks = append(adBreaks, adBreak)
 			}
-		}
 
 		// Track cumulative duration from #EXTINF tags
-		if strings.HasPrefix(line, "#EXTINF:") {
+		case strings.HasPrefix(line, "#EXTINF:"):
 			// Extract duration from #EXTINF:10.5,title
-			parts := strings.Split(line, ",")
-			if len(parts) > 0 {
-				durationStr := strings.TrimPrefix(parts[0], "#EXTINF:")
-				if duration, err := strconv.ParseFloat(durationStr, 64); err == nil {
-					currentOffset += duration
-				}
+			durationStr := strings.TrimPrefix(strings.Split(line, ",")[0], "#EXTINF:")
+			segmentDuration = 0
+			if duration, err := strconv.ParseFloat(durationStr, 64); err == nil {
+				currentOffset += duration
+				segmentDuration = duration
+			}
+
+		case line != "" && !strings.HasPrefix(line, "#"):
+			segmentIndex++
+			if !pdt.IsZero() {
+				pdt = pdt.Add(time.Duration(segmentDuration * float64(time.Second)))
 			}
 		}
 	}
 
+	// Break still airing at the live edge
+	if open != nil {
+		open.EndIndex = segmentIndex
+		adBreaks = append(adBreaks, d.finishCueBreak(manifest, open, openPDT))
+	}
+
 	return adBreaks
 }
 
+// finishCueBreak assigns a cue break an ID that stays the same while the live
+// window slides. With PROGRAM-DATE-TIME it's the (whole second) time the break started
+// at, which is exact while CUE-OUT is in the window and carries over once it left it.
+// Otherwise it's the media sequence number the break started at; once CUE-OUT left the
+// window, the segments aired before it are counted from the break's actual segment
+// durations (TARGETDURATION is rounded up and would drift).
+func (d *AdBreakDetector) finishCueBreak(manifest *models.Manifest, adBreak *models.AdBreak, startPDT time.Time) models.AdBreak {
+	if !startPDT.IsZero() {
+		adBreak.ID = fmt.Sprintf("scte35_t%d", startPDT.Round(time.Second).Unix())
+		return *adBreak
+	}
+
+	startSequence := manifest.MediaSequence + int64(adBreak.StartIndex)
+	if adBreak.Elapsed > 0 {
+		if segmentDuration := d.averageSegmentDuration(manifest, adBreak); segmentDuration > 0 {
+			startSequence -= int64(adBreak.Elapsed/segmentDuration + 0.5)
+		}
+	}
+	adBreak.ID = fmt.Sprintf("scte35_%d", startSequence)
+	return *adBreak
+}
+
+// averageSegmentDuration returns the average EXTINF of a break's segments in the window,
+// or of the whole window (TARGETDURATION if it has none)
+func (d *AdBreakDetector) averageSegmentDuration(manifest *models.Manifest, adBreak *models.AdBreak) float64 {
+	segments := manifest.Segments
+	if adBreak.StartIndex < adBreak.EndIndex && adBreak.EndIndex <= len(segments) {
+		segments = segments[adBreak.StartIndex:adBreak.EndIndex]
+	}
+	if len(segments) == 0 {
+		return float64(manifest.TargetDuration)
+	}
+
+	var total float64
+	for _, seg := range segments {
+		total += seg.Duration
+	}
+	return total / float64(len(segments))
+}
+
+// cueSpanEnd returns the end (exclusive) of the segments from start covering duration
+// seconds, or the end of the window if the break runs past it. Half a second of slack
+// absorbs rounded durations.
+func cueSpanEnd(manifest *models.Manifest, start int, duration float64) int {
+	var covered float64
+	for i := start; i < len(manifest.Segments); i++ {
+		if covered >= duration-0.5 {
+			return i
+		}
+		covered += manifest.Segments[i].Duration
+	}
+	return len(manifest.Segments)
+}
+
+// parseCueOutCont parses #EXT-X-CUE-OUT-CONT:10/30 or
+// #EXT-X-CUE-OUT-CONT:ElapsedTime=10,Duration=30,SCTE35=...
+func parseCueOutCont(line string) (elapsed, duration float64) {
+	value := strings.TrimPrefix(strings.TrimPrefix(line, "#EXT-X-CUE-OUT-CONT"), ":")
+
+	if e, d, ok := strings.Cut(value, "/"); ok && !strings.Contains(value, "=") {
+		elapsed, _ = strconv.ParseFloat(strings.TrimSpace(e), 64)
+		duration, _ = strconv.ParseFloat(strings.TrimSpace(d), 64)
+		return elapsed, duration
+	}
+
+	for _, attr := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(attr, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "elapsedtime":
+			elapsed, _ = strconv.ParseFloat(strings.TrimSpace(val), 64)
+		case "duration":
+			duration, _ = strconv.ParseFloat(strings.TrimSpace(val), 64)
+		}
+	}
+
+	return elapsed, duration
+}
+
 // StaticAdRule represents a static ad break rule
 type StaticAdRule struct {
 	Position string  // pre-roll, mid-roll, post-roll
@@ -122,7 +251,8 @@ type StaticAdRule struct {
 }
 
 // detectStaticRules detects ad breaks based on static rules
-func (d *AdBreakDetector) detectStaticRules(manifest *models.Manifest, rules []StaticAdRule) []models.AdBreak {
+func (d *AdBreakDetector) detectStaticRules(ctx context.Context, manifest *models.Manifest, rules []StaticAdRule) []models.AdBreak {
+	log := logging.FromContext(ctx)
 	adBreaks := []models.AdBreak{}
 
 	// Calculate total duration
@@ -138,8 +268,8 @@ func (d *AdBreakDetector) detectStaticRules(manifest *models.Manifest, rules []S
 				Offset:   0,
 				Duration: rule.Duration,
 				Type:     "static",
+				Slot:     staticSlot("pre-roll", 0),
 			})
-			fmt.Printf("DEBUG: Generated pre-roll ad break (offset: 0, duration: %d)\n", rule.Duration)
 
 		case "mid-roll":
 			if rule.Interval > 0 {
@@ -147,54 +277,23 @@ func (d *AdBreakDetector) detectStaticRules(manifest *models.Manifest, rules []S
 				// For LIVE streams: only generate ad breaks within manifest duration
 				// If interval is larger than manifest duration, insert ad at middle of manifest
 				maxAdBreaks := 5 // Maximum number of ad breaks to generate
-				
-				// For LIVE streams (short manifest), adjust strategy
-				// LIVE streams typically have 3-4 segments (15-24 seconds)
-				// Best practice: For LIVE streams, interval should be much smaller than manifest duration
-				// OR we insert ad at a fixed position (e.g., after first 2-3 segments)
 				if totalDuration < 300 {
-					// LIVE stream: check if interval start is larger than manifest duration
-					if rule.Offset >= totalDuration {
-						// Interval is too large for current manifest window
-						// For LIVE streams: insert ad after first few segments (e.g., at 12-15 seconds)
-						// This ensures ad appears early enough in the window
-						adOffset := totalDuration * 0.5 // 50% of manifest duration
-						if adOffset < 12 {
-							adOffset = 12 // Minimum 12 seconds for ExoPlayer compatibility
-						}
-						if adOffset >= totalDuration {
-							adOffset = totalDuration * 0.75 // Use 75% if 50% is too close to end
-						}
-						
+					// LIVE stream: breaks sit at fixed positions of the sliding window, and each
+					// takes the decision of the schedule slot it has reached on the channel's timeline
+					start := d.windowStart(manifest)
+					offsets := liveMidRollOffsets(rule, totalDuration)
+					for _, offset := range offsets {
 						adBreaks = append(adBreaks, models.AdBreak{
-							ID:       fmt.Sprintf("mid_roll_%.0f", adOffset),
+							ID:       fmt.Sprintf("mid_roll_%.0f", offset),
 							Position: "mid-roll",
-							Offset:   adOffset,
+							Offset:   offset,
 							Duration: rule.Duration,
 							Type:     "static",
+							Slot:     liveSlot(rule, start+offset),
 						})
-						fmt.Printf("DEBUG: LIVE stream - Interval (%.0fs) >= manifest duration (%.0fs), inserting ad at %.0fs (%.0f%% of duration)\n",
-							rule.Offset, totalDuration, adOffset, (adOffset/totalDuration)*100)
-					} else {
-						// Interval fits within manifest - generate ad breaks normally
-						// But limit to only 1-2 ad breaks for LIVE streams to avoid manifest bloat
-						maxDuration := totalDuration
-						maxAdBreaks = 2 // Limit to 2 ad breaks for LIVE streams
-						
-						adBreakCount := 0
-						for offset := rule.Offset; offset < maxDuration && adBreakCount < maxAdBreaks; offset += rule.Interval {
-							adBreaks = append(adBreaks, models.AdBreak{
-								ID:       fmt.Sprintf("mid_roll_%.0f", offset),
-								Position: "mid-roll",
-								Offset:   offset,
-								Duration: rule.Duration,
-								Type:     "static",
-							})
-							adBreakCount++
-						}
-						fmt.Printf("DEBUG: LIVE stream - Generated %d mid-roll ad breaks (interval: %.0fs, max duration: %.0fs, limit: %d)\n",
-							adBreakCount, rule.Interval, maxDuration, maxAdBreaks)
 					}
+					log.Debug("Generated live mid-roll ad breaks", "count", len(offsets), "interval", rule.Interval,
+						"interval_offset", rule.Offset, "manifest_duration", totalDuration, "window_start", start)
 				} else {
 					// VOD stream: generate based on duration
 					maxDuration := totalDuration
@@ -206,11 +305,12 @@ func (d *AdBreakDetector) detectStaticRules(manifest *models.Manifest, rules []S
 							Offset:   offset,
 							Duration: rule.Duration,
 							Type:     "static",
+							Slot:     staticSlot("mid-roll", offset),
 						})
 						adBreakCount++
 					}
-					fmt.Printf("DEBUG: Generated %d mid-roll ad breaks (interval: %.0fs, max duration: %.0fs, limit: %d)\n",
-						adBreakCount, rule.Interval, maxDuration, maxAdBreaks)
+					log.Debug("Generated mid-roll ad breaks", "count", adBreakCount,
+						"interval", rule.Interval, "manifest_duration", maxDuration, "limit", maxAdBreaks)
 				}
 			} else {
 				// Single mid-roll - only add if within reasonable range (10 minutes)
@@ -221,6 +321,7 @@ func (d *AdBreakDetector) detectStaticRules(manifest *models.Manifest, rules []S
 						Offset:   rule.Offset,
 						Duration: rule.Duration,
 						Type:     "static",
+						Slot:     staticSlot("mid-roll", rule.Offset),
 					})
 				}
 			}
@@ -236,6 +337,7 @@ func (d *AdBreakDetector) detectStaticRules(manifest *models.Manifest, rules []S
 				Offset:   postRollOffset,
 				Duration: rule.Duration,
 				Type:     "static",
+				Slot:     staticSlot("post-roll", rule.Offset),
 			})
 		}
 	}
@@ -243,6 +345,113 @@ func (d *AdBreakDetector) detectStaticRules(manifest *models.Manifest, rules []S
 	return adBreaks
 }
 
+// liveMidRollOffsets returns where a repeating mid-roll rule places breaks in a live
+// window of totalDuration seconds
+func liveMidRollOffsets(rule StaticAdRule, totalDuration float64) []float64 {
+	// LIVE streams typically have 3-4 segments (15-24 seconds)
+	// Best practice: For LIVE streams, interval should be much smaller than manifest duration
+	// OR we insert ad at a fixed position (e.g., after first 2-3 segments)
+	if rule.Offset >= totalDuration {
+		// Interval is too large for current manifest window
+		// For LIVE streams: insert ad after first few segments (e.g., at 12-15 seconds)
+		// This ensures ad appears early enough in the window
+		adOffset := totalDuration * 0.5 // 50% of manifest duration
+		if adOffset < 12 {
+			adOffset = 12 // Minimum 12 seconds for ExoPlayer compatibility
+		}
+		if adOffset >= totalDuration {
+			adOffset = totalDuration * 0.75 // Use 75% if 50% is too close to end
+		}
+		return []float64{adOffset}
+	}
+
+	// Interval fits within manifest - generate ad breaks normally
+	// But limit to only 1-2 ad breaks for LIVE streams to avoid manifest bloat
+	const maxAdBreaks = 2
+	var offsets []float64
+	for offset := rule.Offset; offset < totalDuration && len(offsets) < maxAdBreaks; offset += rule.Interval {
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+// liveSlot returns the schedule slot a live break at position (seconds on the channel's
+// timeline) falls in: the last rule.Offset + n*rule.Interval at or before it
+func liveSlot(rule StaticAdRule, position float64) string {
+	n := math.Floor((position - rule.Offset) / rule.Interval)
+	return staticSlot("mid-roll", rule.Offset+n*rule.Interval)
+}
+
+// windowStart returns the position of a live window on the channel's timeline: its
+// PROGRAM-DATE-TIME, or media sequence x target duration for origins without one
+func (d *AdBreakDetector) windowStart(manifest *models.Manifest) float64 {
+	var before float64
+	for _, seg := range manifest.Segments {
+		if seg.ProgramDateTime != nil {
+			return float64(seg.ProgramDateTime.UnixMilli())/1000 - before
+		}
+		before += seg.Duration
+	}
+	return float64(manifest.MediaSequence) * float64(manifest.TargetDuration)
+}
+
+// UpcomingStaticBreaks returns the live mid-rolls that reach their next schedule slot
+// within ahead, so their decisions can be prefetched before the window gets there.
+// Cue-driven windows (detected has scte35 breaks) and VOD playlists, whose breaks are all
+// in the playlist already, have none.
+func (d *AdBreakDetector) UpcomingStaticBreaks(manifest *models.Manifest, rules []StaticAdRule, detected []models.AdBreak, ahead time.Duration) []models.AdBreak {
+	if ahead <= 0 {
+		return nil
+	}
+	scheduled := make(map[string]bool, len(detected))
+	for _, adBreak := range detected {
+		if adBreak.Type == "scte35" {
+			return nil
+		}
+		scheduled[adBreak.Slot] = true
+	}
+
+	totalDuration := d.calculateTotalDuration(manifest)
+	if totalDuration >= 300 {
+		return nil
+	}
+	start := d.windowStart(manifest)
+
+	var upcoming []models.AdBreak
+	for _, rule := range rules {
+		if rule.Position != "mid-roll" || rule.Interval <= 0 {
+			continue
+		}
+		for _, offset := range liveMidRollOffsets(rule, totalDuration) {
+			position := start + offset
+			next := rule.Offset + (math.Floor((position-rule.Offset)/rule.Interval)+1)*rule.Interval
+			if next-position > ahead.Seconds() {
+				continue
+			}
+			slot := liveSlot(rule, next)
+			if scheduled[slot] {
+				continue
+			}
+			scheduled[slot] = true
+			upcoming = append(upcoming, models.AdBreak{
+				ID:       fmt.Sprintf("mid_roll_%.0f", offset),
+				Position: "mid-roll",
+				Offset:   offset,
+				Duration: rule.Duration,
+				Type:     "static",
+				Slot:     slot,
+			})
+		}
+	}
+	return upcoming
+}
+
+// staticSlot names the schedule slot of a static break, so each break of a schedule
+// gets its own decision
+func staticSlot(position string, offset float64) string {
+	return fmt.Sprintf("%s@%.0f", position, offset)
+}
+
 // calculateTotalDuration calculates total duration of all segments
 func (d *AdBreakDetector) calculateTotalDuration(manifest *models.Manifest) float64 {
 	var total float64
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/client"
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+)
+
+const (
+	availHourFormat        = "2006010215"
+	defaultAvailRetention  = 30 * 24 * time.Hour
+	availCounterResolution = 1000 // durations are counted in milliseconds
+)
+
+// AvailRecorder accounts for ad avails: each break is counted once per viewer into
+// hourly per-channel counters, and optionally forwarded to the tracking pipeline
+type AvailRecorder struct {
+	cache         cache.Cache
+	laravelClient *client.LaravelClient
+	forward       bool
+	retention     time.Duration
+}
+
+func NewAvailRecorder(c cache.Cache, laravelClient *client.LaravelClient, cfg config.AvailConfig) *AvailRecorder {
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = defaultAvailRetention
+	}
+
+	return &AvailRecorder{
+		cache:         c,
+		laravelClient: laravelClient,
+		forward:       cfg.Forward,
+		retention:     retention,
+	}
+}
+
+// Record counts an avail unless this viewer's copy of the break was already counted.
+// Players refresh the playlist every few seconds, so the same break is seen many times;
+// seenFor is how long a break counts as seen (at least as long as it stays in the window).
+func (r *AvailRecorder) Record(ctx context.Context, record models.AvailRecord, breakKey, viewerKey string, seenFor time.Duration) {
+	seenKey := fmt.Sprintf("avail_seen:%s:%s:%s:%s", record.Tenant, record.Channel, breakKey, viewerKey)
+	if seen, err := r.cache.IncrBy(ctx, seenKey, 1, seenFor); err != nil {
+		logging.FromContext(ctx).Warn("Failed to dedupe avail", logging.KeyBreakID, record.BreakID, "error", err)
+		return
+	} else if seen > 1 {
+		return
+	}
+
+	hour := time.Now().UTC().Format(availHourFormat)
+	prefix := fmt.Sprintf("avail:%s:%s:%s:", availSlug(record.Tenant), availSlug(record.Channel), hour)
+	counters := map[string]int64{
+		"breaks":       1,
+		"detected_ms":  int64(record.DetectedSeconds * availCounterResolution),
+		"requested_ms": int64(record.RequestedSeconds * availCounterResolution),
+		"filled_ms":    int64(record.FilledSeconds * availCounterResolution),
+		"slate_ms":     int64(record.SlateSeconds * availCounterResolution),
+		"empty_ms":     int64(record.EmptySeconds * availCounterResolution),
+	}
+	for field, value := range counters {
+		if _, err := r.cache.IncrBy(ctx, prefix+field, value, r.retention); err != nil {
+			logging.FromContext(ctx).Warn("Failed to count avail", logging.KeyBreakID, record.BreakID, "counter", field, "error", err)
+		}
+	}
+
+	if r.forward {
+		if err := r.laravelClient.SendAvailRecord(ctx, record); err != nil {
+			logging.FromContext(ctx).Error("Failed to send avail record", logging.KeyBreakID, record.BreakID, "error", err)
+		}
+	}
+}
+
+// availSlug escapes a tenant or channel slug for counter keys, so a ':' in it can't
+// shift the fields Stats reads back
+func availSlug(slug string) string {
+	return url.QueryEscape(slug)
+}
+
+// Stats returns hourly avail aggregates between from and to (inclusive), oldest first.
+// tenant and channel are optional filters.
+func (r *AvailRecorder) Stats(ctx context.Context, tenant, channel string, from, to time.Time) ([]models.AvailStats, error) {
+	prefix := "avail:"
+	if tenant != "" {
+		prefix += availSlug(tenant) + ":"
+		if channel != "" {
+			prefix += availSlug(channel) + ":"
+		}
+	}
+
+	keys, err := r.cache.Keys(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list avail counters: %w", err)
+	}
+
+	from = from.UTC().Truncate(time.Hour)
+	to = to.UTC()
+	buckets := make(map[string]*models.AvailStats)
+	for _, key := range keys {
+		// avail:<tenant>:<channel>:<hour>:<field>
+		parts := strings.Split(key, ":")
+		if len(parts) != 5 || (channel != "" && parts[2] != availSlug(channel)) {
+			continue
+		}
+		keyTenant, err := url.QueryUnescape(parts[1])
+		if err != nil {
+			continue
+		}
+		keyChannel, err := url.QueryUnescape(parts[2])
+		if err != nil {
+			continue
+		}
+		hour, err := time.Parse(availHourFormat, parts[3])
+		if err != nil || hour.Before(from) || hour.After(to) {
+			continue
+		}
+
+		raw, err := r.cache.Get(ctx, key)
+		if err != nil {
+			continue // expired since listed
+		}
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		bucketKey := strings.Join(parts[1:4], ":")
+		stats, ok := buckets[bucketKey]
+		if !ok {
+			stats = &models.AvailStats{Tenant: keyTenant, Channel: keyChannel, Hour: hour.Format(time.RFC3339)}
+			buckets[bucketKey] = stats
+		}
+
+		seconds := float64(value) / availCounterResolution
+		switch parts[4] {
+		case "breaks":
+			stats.Breaks = value
+		case "detected_ms":
+			stats.DetectedSeconds = seconds
+		case "requested_ms":
+			stats.RequestedSeconds = seconds
+		case "filled_ms":
+			stats.FilledSeconds = seconds
+		case "slate_ms":
+			stats.SlateSeconds = seconds
+		case "empty_ms":
+			stats.EmptySeconds = seconds
+		}
+	}
+
+	result := make([]models.AvailStats, 0, len(buckets))
+	for _, stats := range buckets {
+		if stats.RequestedSeconds > 0 {
+			stats.FillRate = stats.FilledSeconds / stats.RequestedSeconds
+		}
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Hour != result[j].Hour {
+			return result[i].Hour < result[j].Hour
+		}
+		if result[i].Tenant != result[j].Tenant {
+			return result[i].Tenant < result[j].Tenant
+		}
+		return result[i].Channel < result[j].Channel
+	})
+
+	return result, nil
+}
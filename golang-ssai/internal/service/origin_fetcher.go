@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"golang.org/x/sync/singleflight"
+)
+
+// originTTLFraction is the share of a playlist's target duration it stays cached;
+// a fraction keeps viewers within one segment of the origin's live edge
+const originTTLFraction = 0.5
+
+// originFetchTimeout bounds a shared origin fetch once it's detached from the viewers waiting on it
+const originFetchTimeout = 10 * time.Second
+
+// OriginFetcher coalesces origin playlist fetches: concurrent requests for the same
+// playlist share one in-flight fetch, and the result is cached briefly for every viewer
+type OriginFetcher struct {
+	cache  cache.Cache
+	maxTTL time.Duration
+	group  singleflight.Group
+}
+
+// NewOriginFetcher creates the fetcher. Playlists are cached for a fraction of their
+// target duration, at most maxTTL (masters, which have none, for maxTTL); maxTTL <= 0
+// disables caching but fetches are still coalesced.
+func NewOriginFetcher(c cache.Cache, maxTTL time.Duration) *OriginFetcher {
+	return &OriginFetcher{cache: c, maxTTL: maxTTL}
+}
+
+// Fetch returns the playlist at originURL, calling fetch only if no fresh copy is
+// cached and no other request is already fetching it
+func (f *OriginFetcher) Fetch(ctx context.Context, originURL string, fetch func(ctx context.Context) (string, error)) (string, error) {
+	key := originKey(originURL)
+
+	if f.maxTTL > 0 {
+		if playlist, err := f.cache.Get(ctx, key); err == nil && playlist != "" {
+			logging.FromContext(ctx).Debug("Origin cache hit", "url", originURL)
+			return playlist, nil
+		}
+	}
+
+	// Detach the fetch from the caller's cancellation: other viewers may be waiting on it
+	ch := f.group.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), originFetchTimeout)
+		defer cancel()
+
+		playlist, err := fetch(fetchCtx)
+		if err != nil {
+			return "", err
+		}
+
+		if ttl := f.ttl(playlist); ttl > 0 {
+			if err := f.cache.Set(fetchCtx, key, playlist, ttl); err != nil {
+				logging.FromContext(ctx).Warn("Failed to cache origin playlist", "url", originURL, "error", err)
+			}
+		}
+		return playlist, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		if res.Shared {
+			logging.FromContext(ctx).Debug("Origin fetch coalesced", "url", originURL)
+		}
+		return res.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// ttl returns how long a playlist may be served from cache
+func (f *OriginFetcher) ttl(playlist string) time.Duration {
+	if f.maxTTL <= 0 {
+		return 0
+	}
+
+	targetDuration := playlistTargetDuration(playlist)
+	if targetDuration <= 0 {
+		return f.maxTTL
+	}
+
+	ttl := time.Duration(targetDuration * originTTLFraction * float64(time.Second))
+	if ttl > f.maxTTL {
+		ttl = f.maxTTL
+	}
+	return ttl
+}
+
+func originKey(originURL string) string {
+	sum := sha256.Sum256([]byte(originURL))
+	return "origin:" + hex.EncodeToString(sum[:])
+}
+
+// playlistTargetDuration returns the #EXT-X-TARGETDURATION of a media playlist (0 if absent)
+func playlistTargetDuration(playlist string) float64 {
+	const tag = "#EXT-X-TARGETDURATION:"
+
+	i := strings.Index(playlist, tag)
+	if i < 0 {
+		return 0
+	}
+	value := playlist[i+len(tag):]
+	if end := strings.IndexAny(value, "\r\n"); end >= 0 {
+		value = value[:end]
+	}
+
+	targetDuration, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return targetDuration
+}
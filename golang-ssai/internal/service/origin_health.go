@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+)
+
+// OriginHealth tracks the health of each origin URL: fetch failures, and live playlists
+// whose media sequence stops advancing (a stuck packager). Failures are counted on each
+// instance, but an origin taken out of rotation is out for every instance (through the
+// shared cache), so instances don't disagree on which origin a channel is served from.
+type OriginHealth struct {
+	failureThreshold int
+	staleAfter       float64 // target durations without a new segment
+	failback         time.Duration
+	cache            cache.Cache
+
+	mu      sync.Mutex
+	origins map[string]*originStatus
+}
+
+type originStatus struct {
+	failures       int
+	unhealthyUntil time.Time
+	windowEnd      int64     // media sequence after the newest segment seen
+	advancedAt     time.Time // when windowEnd last moved
+}
+
+// NewOriginHealth creates the tracker with the configured thresholds, sharing unhealthy
+// origins through c
+func NewOriginHealth(cfg config.OriginFailoverConfig, c cache.Cache) *OriginHealth {
+	h := &OriginHealth{
+		failureThreshold: cfg.FailureThreshold,
+		staleAfter:       cfg.StaleTargetDurations,
+		failback:         cfg.FailbackAfter,
+		cache:            c,
+		origins:          make(map[string]*originStatus),
+	}
+	if h.failureThreshold <= 0 {
+		h.failureThreshold = 1
+	}
+	if h.staleAfter <= 0 {
+		h.staleAfter = 3
+	}
+	if h.failback <= 0 {
+		h.failback = 30 * time.Second
+	}
+	return h
+}
+
+func (h *OriginHealth) status(originURL string) *originStatus {
+	s, ok := h.origins[originURL]
+	if !ok {
+		s = &originStatus{}
+		h.origins[originURL] = s
+	}
+	return s
+}
+
+// Healthy reports whether an origin may be used: it hasn't failed recently (on any
+// instance), or it's been long enough since it failed to try it again
+func (h *OriginHealth) Healthy(ctx context.Context, originURL string) bool {
+	h.mu.Lock()
+	healthy := time.Now().After(h.status(originURL).unhealthyUntil)
+	h.mu.Unlock()
+	if !healthy {
+		return false
+	}
+
+	_, err := h.cache.Get(ctx, unhealthyKey(originURL))
+	return err != nil // unknown when the cache fails: go by this instance
+}
+
+// FailbackAfter is how long an origin is skipped after failing, and how long the
+// service stays on a backup origin before trying to fail back
+func (h *OriginHealth) FailbackAfter() time.Duration {
+	return h.failback
+}
+
+// Failure records a failed fetch; the origin is skipped for failback_after once it has
+// failed failure_threshold times in a row
+func (h *OriginHealth) Failure(ctx context.Context, originURL string) {
+	h.mu.Lock()
+	s := h.status(originURL)
+	s.failures++
+	unhealthy := s.failures >= h.failureThreshold
+	if unhealthy {
+		s.unhealthyUntil = time.Now().Add(h.failback)
+	}
+	h.mu.Unlock()
+
+	if unhealthy {
+		h.share(ctx, originURL)
+	}
+}
+
+// Unhealthy takes an origin out of rotation for failback_after, e.g. when its playlist
+// has an issue listed in playlist_health.failover_on
+func (h *OriginHealth) Unhealthy(ctx context.Context, originURL string) {
+	h.mu.Lock()
+	h.status(originURL).unhealthyUntil = time.Now().Add(h.failback)
+	h.mu.Unlock()
+
+	h.share(ctx, originURL)
+}
+
+// Observe records a fetched media playlist and reports whether it's stale: a live
+// playlist without a new segment for stale_target_durations target durations. Stale
+// origins are marked unhealthy.
+func (h *OriginHealth) Observe(ctx context.Context, originURL string, w hls.Window) bool {
+	if !h.observe(originURL, w) {
+		return false
+	}
+	h.share(ctx, originURL)
+	return true
+}
+
+func (h *OriginHealth) observe(originURL string, w hls.Window) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	s := h.status(originURL)
+	if w.End() != s.windowEnd || s.advancedAt.IsZero() || w.EndList {
+		s.windowEnd = w.End()
+		s.advancedAt = now
+		s.failures = 0
+		return false
+	}
+
+	targetDuration := w.TargetDuration
+	if targetDuration <= 0 {
+		targetDuration = 6
+	}
+	staleFor := time.Duration(h.staleAfter * targetDuration * float64(time.Second))
+	if now.Sub(s.advancedAt) <= staleFor {
+		s.failures = 0
+		return false
+	}
+
+	s.unhealthyUntil = now.Add(h.failback)
+	// Give the origin a fresh staleness window when it's tried again
+	s.advancedAt = time.Time{}
+	return true
+}
+
+// share takes an unhealthy origin out of rotation on every instance for failback_after
+func (h *OriginHealth) share(ctx context.Context, originURL string) {
+	metrics.OriginUnhealthy.WithLabelValues(originHost(originURL)).Inc()
+	if err := h.cache.Set(ctx, unhealthyKey(originURL), "1", h.failback); err != nil {
+		logging.FromContext(ctx).Warn("Failed to share unhealthy origin", "origin_url", originURL, "error", err)
+	}
+}
+
+func unhealthyKey(originURL string) string {
+	return "origin_unhealthy:" + originURL
+}
+
+// originHost labels origin metrics by host to keep their cardinality bounded
+func originHost(originURL string) string {
+	u, err := url.Parse(originURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
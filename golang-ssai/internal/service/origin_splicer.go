@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+)
+
+// spliceTTL is how long a channel's splice state outlives its last update
+const spliceTTL = 24 * time.Hour
+
+// OriginSplice is the origin a channel is served from and how its playlists are
+// renumbered so players see one continuous stream across origin switches
+type OriginSplice struct {
+	Origin     string    `json:"origin"`
+	SwitchedAt time.Time `json:"switched_at"`
+	SeqOffset  int64     `json:"seq_offset"`  // added to the origin's media sequence
+	DiscOffset int64     `json:"disc_offset"` // added to the origin's discontinuity sequence
+	// Origin media sequence of the first segment after the switch, which gets an
+	// EXT-X-DISCONTINUITY while it's in the window (-1 once it has slid out)
+	SwitchSeq int64         `json:"switch_seq"`
+	Last      SplicedWindow `json:"last"` // last window served, renumbered
+
+	raw string // cached state it was loaded from, to detect concurrent updates
+}
+
+// SplicedWindow is a renumbered window as served to players
+type SplicedWindow struct {
+	MediaSequence         int64 `json:"media_sequence"`
+	End                   int64 `json:"end"`
+	DiscontinuitySequence int64 `json:"discontinuity_sequence"`
+	Discontinuities       int   `json:"discontinuities"`
+}
+
+// spliceAttempts bounds how often a splice is redone after losing a race with another
+// instance updating the same channel
+const spliceAttempts = 3
+
+// OriginSplicer keeps each channel's splice state in the shared cache, so every
+// instance numbers a channel's playlists the same way. State is always read from the
+// shared tier and updated with compare-and-swap, so instances never act on a stale copy
+// or overwrite each other's origin switch.
+type OriginSplicer struct {
+	cache cache.Cache
+}
+
+func NewOriginSplicer(c cache.Cache) *OriginSplicer {
+	return &OriginSplicer{cache: cache.Shared(c)}
+}
+
+// Load returns the splice state of a channel (nil if it has none yet)
+func (s *OriginSplicer) Load(ctx context.Context, channelKey string) *OriginSplice {
+	raw, err := s.cache.Get(ctx, spliceKey(channelKey))
+	if err != nil || raw == "" {
+		return nil
+	}
+
+	var splice OriginSplice
+	if err := json.Unmarshal([]byte(raw), &splice); err != nil {
+		return nil
+	}
+	splice.raw = raw
+	return &splice
+}
+
+// Splice renumbers a media playlist from originURL. When the channel was last served
+// from another origin it switches: the playlist continues the previous origin's numbering
+// after an EXT-X-DISCONTINUITY. It reports whether the origin switched.
+// When another instance updated the channel since current was loaded, the splice is
+// redone on top of its state; a switch to another origin made meanwhile is never undone.
+func (s *OriginSplicer) Splice(ctx context.Context, channelKey string, current *OriginSplice, originURL, playlist string) (string, bool) {
+	w := hls.ScanWindow(playlist)
+
+	var splice OriginSplice
+	var breakIndex int
+	var switched bool
+	for attempt := 1; ; attempt++ {
+		splice, breakIndex, switched = nextSplice(current, w, originURL)
+		if current != nil && !switched && splice == current.withoutRaw() {
+			break
+		}
+		if s.save(ctx, channelKey, current, splice) || attempt == spliceAttempts {
+			break
+		}
+
+		latest := s.Load(ctx, channelKey)
+		if latest != nil && latest.Origin != originURL && (current == nil || latest.Origin != current.Origin) {
+			// Another instance switched the channel to another origin first: keep its switch
+			// (this instance follows once it loads it) and serve this window unsaved
+			logging.FromContext(ctx).Warn("Channel switched origin concurrently, not overriding",
+				"origin_url", originURL, "active_origin", latest.Origin)
+			switched = false
+			break
+		}
+		current = latest
+	}
+
+	if splice.SeqOffset == 0 && splice.DiscOffset == 0 && breakIndex < 0 {
+		return playlist, switched
+	}
+	return hls.Resequence(playlist, splice.Last.MediaSequence, splice.Last.DiscontinuitySequence, breakIndex), switched
+}
+
+// nextSplice returns the splice state after serving window w from originURL, the index
+// of the segment that gets the switch discontinuity (-1 if none) and whether it switched
+func nextSplice(current *OriginSplice, w hls.Window, originURL string) (OriginSplice, int, bool) {
+	var splice OriginSplice
+	switched := false
+	switch {
+	case current == nil:
+		splice = OriginSplice{Origin: originURL, SwitchedAt: time.Now(), SwitchSeq: -1}
+	case current.Origin != originURL:
+		// The first segment of this window follows the last one served from the previous origin
+		splice = OriginSplice{
+			Origin:     originURL,
+			SwitchedAt: time.Now(),
+			SeqOffset:  current.Last.End - w.MediaSequence,
+			DiscOffset: current.Last.DiscontinuitySequence + int64(current.Last.Discontinuities) - w.DiscontinuitySequence,
+			SwitchSeq:  w.MediaSequence,
+		}
+		switched = true
+	default:
+		splice = current.withoutRaw()
+	}
+
+	// Once the switch segment slides out, its discontinuity moves into the sequence
+	if splice.SwitchSeq >= 0 && splice.SwitchSeq < w.MediaSequence {
+		splice.SwitchSeq = -1
+		splice.DiscOffset++
+	}
+
+	breakIndex := -1
+	if splice.SwitchSeq >= 0 && splice.SwitchSeq-w.MediaSequence < int64(w.Segments) {
+		breakIndex = int(splice.SwitchSeq - w.MediaSequence)
+	}
+
+	splice.Last = SplicedWindow{
+		MediaSequence:         w.MediaSequence + splice.SeqOffset,
+		DiscontinuitySequence: w.DiscontinuitySequence + splice.DiscOffset,
+		Discontinuities:       w.Discontinuities,
+	}
+	splice.Last.End = splice.Last.MediaSequence + int64(w.Segments)
+	if breakIndex >= 0 {
+		splice.Last.Discontinuities++
+	}
+
+	return splice, breakIndex, switched
+}
+
+// withoutRaw returns a copy of the splice without the state it was loaded from
+func (o *OriginSplice) withoutRaw() OriginSplice {
+	splice := *o
+	splice.raw = ""
+	return splice
+}
+
+// save stores splice if the channel's state is still current, and reports whether it
+// did. Caches without compare-and-swap (or errors) fall back to a plain write.
+func (s *OriginSplicer) save(ctx context.Context, channelKey string, current *OriginSplice, splice OriginSplice) bool {
+	data, err := json.Marshal(splice)
+	if err != nil {
+		return true
+	}
+
+	swapper, ok := s.cache.(cache.Swapper)
+	if !ok {
+		if err := s.cache.Set(ctx, spliceKey(channelKey), string(data), spliceTTL); err != nil {
+			logging.FromContext(ctx).Warn("Failed to save origin splice state", "error", err)
+		}
+		return true
+	}
+
+	var old string
+	if current != nil {
+		old = current.raw
+	}
+	swapped, err := swapper.CompareAndSwap(ctx, spliceKey(channelKey), old, string(data), spliceTTL)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to save origin splice state", "error", err)
+		return true
+	}
+	if !swapped {
+		logging.FromContext(ctx).Debug("Origin splice state changed concurrently, splicing again", "origin_url", splice.Origin)
+	}
+	return swapped
+}
+
+func spliceKey(channelKey string) string {
+	return "origin_splice:" + channelKey
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fast-ads-backend/golang-ssai/internal/cache"
+	"github.com/fast-ads-backend/golang-ssai/internal/config"
+	"github.com/fast-ads-backend/golang-ssai/internal/logging"
+	"github.com/fast-ads-backend/golang-ssai/internal/metrics"
+	"github.com/fast-ads-backend/golang-ssai/internal/models"
+	"github.com/fast-ads-backend/golang-ssai/internal/tracing"
+	"github.com/fast-ads-backend/golang-ssai/pkg/hls"
+)
+
+// Origin playlist issues
+const (
+	IssueStale           = "stale"              // no new segment for stale_target_durations target durations
+	IssueBackwards       = "sequence_backwards" // the media sequence went backwards
+	IssueTargetDuration  = "target_duration"    // a segment is longer than EXT-X-TARGETDURATION
+	IssueMissingSegments = "missing_segments"   // segments left the window between two polls without being listed
+	IssuePDTGap          = "pdt_gap"            // PROGRAM-DATE-TIME jumps between consecutive segments
+)
+
+const (
+	defaultPDTGapTolerance = time.Second
+	defaultStatusTTL       = time.Hour
+	// maxMonitoredPlaylists bounds the playlists tracked in memory (one per channel and origin)
+	maxMonitoredPlaylists = 10000
+	alertTimeout          = 5 * time.Second
+)
+
+// PlaylistMonitor checks every origin playlist poll for pathologies (a frozen or
+// rewinding media sequence, over-long segments, skipped segments, PDT gaps). Issues are
+// logged, exported as metrics, optionally sent to an alert webhook and kept per channel
+// in the shared cache for GET /admin/playlist-health.
+type PlaylistMonitor struct {
+	cache           cache.Cache
+	staleAfter      float64 // target durations without a new segment
+	pdtGapTolerance time.Duration
+	failoverOn      map[string]bool
+	alertURL        string
+	statusTTL       time.Duration
+	httpClient      *http.Client
+
+	mu        sync.Mutex
+	playlists map[string]*playlistState
+}
+
+// playlistState is what this instance last saw of a channel's playlist on one origin
+type playlistState struct {
+	mu             sync.Mutex
+	tenant         string
+	channel        string
+	originURL      string
+	window         hls.Window
+	windowDuration time.Duration
+	checkedAt      time.Time
+	advancedAt     time.Time
+	issues         map[string]models.PlaylistIssue
+}
+
+// playlistAlert is the body POSTed to the alert webhook
+type playlistAlert struct {
+	Tenant     string `json:"tenant"`
+	Channel    string `json:"channel"`
+	OriginURL  string `json:"origin_url"`
+	Issue      string `json:"issue"`
+	Detail     string `json:"detail"`
+	DetectedAt string `json:"detected_at"`
+}
+
+// NewPlaylistMonitor creates the monitor; stale playlists are judged by the origin
+// failover settings so both agree on what stale means
+func NewPlaylistMonitor(cfg *config.Config, c cache.Cache) *PlaylistMonitor {
+	m := &PlaylistMonitor{
+		cache:           c,
+		staleAfter:      cfg.OriginFailover.StaleTargetDurations,
+		pdtGapTolerance: cfg.PlaylistHealth.PDTGapTolerance,
+		failoverOn:      make(map[string]bool, len(cfg.PlaylistHealth.FailoverOn)),
+		alertURL:        cfg.PlaylistHealth.AlertWebhookURL,
+		statusTTL:       cfg.PlaylistHealth.StatusTTL,
+		httpClient: &http.Client{
+			Timeout:   alertTimeout,
+			Transport: metrics.InstrumentTransport("alert", tracing.Transport(nil)),
+		},
+		playlists: make(map[string]*playlistState),
+	}
+	for _, issue := range cfg.PlaylistHealth.FailoverOn {
+		m.failoverOn[issue] = true
+	}
+	if m.staleAfter <= 0 {
+		m.staleAfter = 3
+	}
+	if m.pdtGapTolerance <= 0 {
+		m.pdtGapTolerance = defaultPDTGapTolerance
+	}
+	if m.statusTTL <= 0 {
+		m.statusTTL = defaultStatusTTL
+	}
+	return m
+}
+
+// FailsOver reports whether any of issues should take the origin out of rotation
+func (m *PlaylistMonitor) FailsOver(issues []string) bool {
+	for _, issue := range issues {
+		if m.failoverOn[issue] {
+			return true
+		}
+	}
+	return false
+}
+
+// Check inspects a media playlist polled from originURL and returns its issues. Segment
+// checks only run when the window changed since the last poll; until then its issues stand.
+func (m *PlaylistMonitor) Check(ctx context.Context, tenant, channel, originURL, content string) []string {
+	st := m.state(tenant, channel, originURL)
+	now := time.Now()
+	w := hls.ScanWindow(content)
+
+	st.mu.Lock()
+	first := st.checkedAt.IsZero()
+	changed := first || w.MediaSequence != st.window.MediaSequence || w.End() != st.window.End()
+
+	found := make(map[string]string) // issue -> detail
+	if changed {
+		if !first {
+			m.compareWindows(st, w, now, found)
+		}
+		if first || w.End() != st.window.End() {
+			st.advancedAt = now
+		}
+		st.window = w
+		if manifest, err := hls.ParseManifest(content); err == nil {
+			st.windowDuration = m.checkSegments(manifest, found)
+		}
+	} else {
+		for issue, existing := range st.issues {
+			if issue != IssueStale {
+				found[issue] = existing.Detail
+			}
+		}
+	}
+
+	targetDuration := w.TargetDuration
+	if targetDuration <= 0 {
+		targetDuration = 6
+	}
+	age := now.Sub(st.advancedAt)
+	if !w.EndList && age > time.Duration(m.staleAfter*targetDuration*float64(time.Second)) {
+		found[IssueStale] = fmt.Sprintf("media sequence stuck at %d", w.End())
+	}
+
+	st.checkedAt = now
+	added, cleared := st.update(found, now)
+	status := st.status()
+	st.mu.Unlock()
+
+	log := logging.FromContext(ctx)
+	metrics.PlaylistAge.WithLabelValues(tenant, channel).Set(age.Seconds())
+	for _, issue := range added {
+		metrics.PlaylistIssues.WithLabelValues(tenant, channel, issue).Inc()
+		metrics.PlaylistIssueActive.WithLabelValues(tenant, channel, issue).Set(1)
+		log.Warn("Origin playlist issue", "origin_url", originURL, "issue", issue, "detail", found[issue])
+		m.alert(ctx, playlistAlert{
+			Tenant:     tenant,
+			Channel:    channel,
+			OriginURL:  originURL,
+			Issue:      issue,
+			Detail:     found[issue],
+			DetectedAt: now.UTC().Format(time.RFC3339),
+		})
+	}
+	for _, issue := range cleared {
+		metrics.PlaylistIssueActive.WithLabelValues(tenant, channel, issue).Set(0)
+		log.Info("Origin playlist issue resolved", "origin_url", originURL, "issue", issue)
+	}
+	if changed || len(added) > 0 || len(cleared) > 0 {
+		m.save(ctx, status)
+	}
+
+	issues := make([]string, 0, len(found))
+	for issue := range found {
+		issues = append(issues, issue)
+	}
+	sort.Strings(issues)
+	return issues
+}
+
+// compareWindows checks a new window against the previous poll's
+func (m *PlaylistMonitor) compareWindows(st *playlistState, w hls.Window, now time.Time, found map[string]string) {
+	prev := st.window
+	switch {
+	case w.MediaSequence < prev.MediaSequence || w.End() < prev.End():
+		found[IssueBackwards] = fmt.Sprintf("media sequence went from %d to %d", prev.MediaSequence, w.MediaSequence)
+	case w.MediaSequence > prev.End() && now.Sub(st.checkedAt) < st.windowDuration:
+		// Polled within a window's duration, so these segments should have been listed
+		found[IssueMissingSegments] = fmt.Sprintf("segments %d-%d were never listed", prev.End(), w.MediaSequence-1)
+	}
+}
+
+// checkSegments checks segment durations and PDT continuity, and returns the window's duration
+func (m *PlaylistMonitor) checkSegments(manifest *hls.Manifest, found map[string]string) time.Duration {
+	var total time.Duration
+	longSegments := 0
+	for i, seg := range manifest.Segments {
+		duration := time.Duration(seg.Duration * float64(time.Second))
+		total += duration
+
+		// EXTINF rounded to the nearest second must not exceed the target duration
+		if manifest.TargetDuration > 0 && math.Round(seg.Duration) > manifest.TargetDuration {
+			longSegments++
+			if longSegments == 1 {
+				found[IssueTargetDuration] = fmt.Sprintf("segment %d is %.3fs, target duration is %gs",
+					manifest.MediaSequence+int64(i), seg.Duration, manifest.TargetDuration)
+			}
+		}
+
+		if i == 0 || seg.Discontinuity || seg.ProgramDateTime == nil {
+			continue
+		}
+		prev := manifest.Segments[i-1]
+		if prev.ProgramDateTime == nil {
+			continue
+		}
+		expected := prev.ProgramDateTime.Add(time.Duration(prev.Duration * float64(time.Second)))
+		if gap := seg.ProgramDateTime.Sub(expected); gap > m.pdtGapTolerance || gap < -m.pdtGapTolerance {
+			if _, ok := found[IssuePDTGap]; !ok {
+				found[IssuePDTGap] = fmt.Sprintf("PDT jumps %s before segment %d", gap, manifest.MediaSequence+int64(i))
+			}
+		}
+	}
+	if longSegments > 1 {
+		found[IssueTargetDuration] += fmt.Sprintf(" (%d segments over)", longSegments)
+	}
+	return total
+}
+
+// update replaces the active issues with found and returns those added and cleared
+func (st *playlistState) update(found map[string]string, now time.Time) (added, cleared []string) {
+	for issue, detail := range found {
+		existing, ok := st.issues[issue]
+		if !ok {
+			existing = models.PlaylistIssue{Type: issue, Since: now.UTC().Format(time.RFC3339)}
+			added = append(added, issue)
+		}
+		existing.Detail = detail
+		st.issues[issue] = existing
+	}
+	for issue := range st.issues {
+		if _, ok := found[issue]; !ok {
+			delete(st.issues, issue)
+			cleared = append(cleared, issue)
+		}
+	}
+	return added, cleared
+}
+
+func (st *playlistState) status() models.PlaylistHealth {
+	status := models.PlaylistHealth{
+		Tenant:         st.tenant,
+		Channel:        st.channel,
+		OriginURL:      st.originURL,
+		MediaSequence:  st.window.MediaSequence,
+		Segments:       st.window.Segments,
+		TargetDuration: st.window.TargetDuration,
+		EndList:        st.window.EndList,
+		LastAdvancedAt: st.advancedAt.UTC().Format(time.RFC3339),
+		CheckedAt:      st.checkedAt.UTC().Format(time.RFC3339),
+		Healthy:        len(st.issues) == 0,
+		Issues:         make([]models.PlaylistIssue, 0, len(st.issues)),
+	}
+	for _, issue := range st.issues {
+		status.Issues = append(status.Issues, issue)
+	}
+	sort.Slice(status.Issues, func(i, j int) bool { return status.Issues[i].Type < status.Issues[j].Type })
+	return status
+}
+
+// state returns the playlist state of a channel on an origin, creating it on first poll
+func (m *PlaylistMonitor) state(tenant, channel, originURL string) *playlistState {
+	key := tenant + "/" + channel + "|" + originURL
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.playlists[key]
+	if ok {
+		return st
+	}
+	if len(m.playlists) >= maxMonitoredPlaylists {
+		m.prune()
+	}
+	st = &playlistState{
+		tenant:    tenant,
+		channel:   channel,
+		originURL: originURL,
+		issues:    make(map[string]models.PlaylistIssue),
+	}
+	m.playlists[key] = st
+	return st
+}
+
+// prune forgets playlists that haven't been polled for status_ttl
+func (m *PlaylistMonitor) prune() {
+	cutoff := time.Now().Add(-m.statusTTL)
+	for key, st := range m.playlists {
+		st.mu.Lock()
+		idle := st.checkedAt.Before(cutoff)
+		st.mu.Unlock()
+		if idle {
+			delete(m.playlists, key)
+		}
+	}
+}
+
+func (m *PlaylistMonitor) save(ctx context.Context, status models.PlaylistHealth) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if err := m.cache.Set(ctx, playlistHealthKey(status.Tenant, status.Channel, status.OriginURL), string(data), m.statusTTL); err != nil {
+		logging.FromContext(ctx).Warn("Failed to save playlist health", "error", err)
+	}
+}
+
+// alert POSTs a new issue to the alert webhook, if one is configured
+func (m *PlaylistMonitor) alert(ctx context.Context, alert playlistAlert) {
+	if m.alertURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	go func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, alertTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.alertURL, bytes.NewReader(body))
+		if err != nil {
+			logging.FromContext(ctx).Error("Failed to create playlist alert", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := m.httpClient.Do(req)
+		if err != nil {
+			logging.FromContext(ctx).Warn("Failed to send playlist alert", "issue", alert.Issue, "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logging.FromContext(ctx).Warn("Playlist alert rejected", "issue", alert.Issue, "status", resp.StatusCode)
+		}
+	}(context.WithoutCancel(ctx))
+}
+
+// Statuses returns the playlist health of every channel polled within status_ttl, by any
+// instance. tenant and channel are optional filters.
+func (m *PlaylistMonitor) Statuses(ctx context.Context, tenant, channel string, unhealthyOnly bool) ([]models.PlaylistHealth, error) {
+	prefix := "playlist_health:"
+	if tenant != "" {
+		prefix += tenant + ":"
+		if channel != "" {
+			prefix += channel + ":"
+		}
+	}
+
+	keys, err := m.cache.Keys(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playlist health: %w", err)
+	}
+
+	result := make([]models.PlaylistHealth, 0, len(keys))
+	for _, key := range keys {
+		raw, err := m.cache.Get(ctx, key)
+		if err != nil {
+			continue // expired since listed
+		}
+		var status models.PlaylistHealth
+		if err := json.Unmarshal([]byte(raw), &status); err != nil {
+			continue
+		}
+		if (channel != "" && status.Channel != channel) || (unhealthyOnly && status.Healthy) {
+			continue
+		}
+		result = append(result, status)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Tenant != result[j].Tenant {
+			return result[i].Tenant < result[j].Tenant
+		}
+		if result[i].Channel != result[j].Channel {
+			return result[i].Channel < result[j].Channel
+		}
+		return result[i].OriginURL < result[j].OriginURL
+	})
+	return result, nil
+}
+
+// playlistHealthKey is playlist_health:<tenant>:<channel>:<origin hash>
+func playlistHealthKey(tenant, channel, originURL string) string {
+	sum := sha256.Sum256([]byte(originURL))
+	return fmt.Sprintf("playlist_health:%s:%s:%s", tenant, channel, hex.EncodeToString(sum[:8]))
+}
@@ -0,0 +1,97 @@
+package service
+
+// maxExhaustivePod is the largest pod fitted by trying every combination of ads;
+// larger pods fall back to a greedy fit in priority order
+const maxExhaustivePod = 12
+
+// PodFitter selects which ads of a pod play in a break so the pod never
+// overruns the signaled avail by more than Tolerance seconds
+type PodFitter struct {
+	Tolerance float64
+}
+
+func NewPodFitter(tolerance float64) *PodFitter {
+	return &PodFitter{Tolerance: tolerance}
+}
+
+// Fit returns the indexes (in ad-server priority order) of the ads to play.
+// durations are the actual ad durations in priority order; breakDuration <= 0 means
+// the avail length is unknown and every ad is kept.
+// When the pod overruns, the combination filling the most of the break wins;
+// ties go to the combination containing the higher priority ads.
+func (f *PodFitter) Fit(durations []float64, breakDuration float64) []int {
+	all := make([]int, len(durations))
+	var total float64
+	for i, d := range durations {
+		all[i] = i
+		total += d
+	}
+
+	limit := breakDuration + f.Tolerance
+	if breakDuration <= 0 || total <= limit {
+		return all
+	}
+
+	var fitted []int
+	if len(durations) <= maxExhaustivePod {
+		fitted = f.fitExhaustive(durations, limit)
+	} else {
+		fitted = f.fitGreedy(durations, limit)
+	}
+	return fitted
+}
+
+// fitExhaustive tries every combination of ads
+func (f *PodFitter) fitExhaustive(durations []float64, limit float64) []int {
+	bestMask, bestTotal := 0, 0.0
+
+	for mask := 1; mask < 1<<len(durations); mask++ {
+		var total float64
+		for i, d := range durations {
+			if mask&(1<<i) != 0 {
+				total += d
+			}
+		}
+		if total > limit {
+			continue
+		}
+		// Prefer fuller pods; on ties prefer higher priority ads (lower indexes)
+		if total > bestTotal+0.001 || (total > bestTotal-0.001 && higherPriority(mask, bestMask)) {
+			bestMask, bestTotal = mask, total
+		}
+	}
+
+	fitted := []int{}
+	for i := range durations {
+		if bestMask&(1<<i) != 0 {
+			fitted = append(fitted, i)
+		}
+	}
+	return fitted
+}
+
+// fitGreedy keeps ads in priority order as long as they fit
+func (f *PodFitter) fitGreedy(durations []float64, limit float64) []int {
+	fitted := []int{}
+	var total float64
+	for i, d := range durations {
+		if total+d <= limit {
+			fitted = append(fitted, i)
+			total += d
+		}
+	}
+	return fitted
+}
+
+// higherPriority reports whether combination a contains higher priority ads than b
+func higherPriority(a, b int) bool {
+	for i := 0; a != 0 || b != 0; i++ {
+		inA, inB := a&(1<<i) != 0, b&(1<<i) != 0
+		if inA != inB {
+			return inA
+		}
+		a &^= 1 << i
+		b &^= 1 << i
+	}
+	return false
+}
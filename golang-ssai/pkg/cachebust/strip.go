@@ -0,0 +1,61 @@
+package cachebust
+
+import (
+	"net/url"
+	"strings"
+)
+
+// params are query parameters ad servers and CDNs commonly use as cache busters
+var params = map[string]bool{
+	"cb":           true,
+	"cachebuster":  true,
+	"cachebusting": true,
+	"cache_buster": true,
+	"correlator":   true,
+	"rand":         true,
+	"random":       true,
+	"rnd":          true,
+	"ord":          true,
+	"ts":           true,
+	"timestamp":    true,
+	"_":            true,
+}
+
+// Strip returns rawURL without cache-busting query parameters, unexpanded
+// macros (e.g. [CACHEBUSTING], {random}) and fragments, with the remaining
+// query sorted so equivalent URLs compare equal.
+// Returns rawURL unchanged if it cannot be parsed.
+func Strip(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return rawURL
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+
+	query := u.Query()
+	for key, values := range query {
+		if params[strings.ToLower(key)] {
+			query.Del(key)
+			continue
+		}
+		for _, v := range values {
+			if isMacro(v) {
+				query.Del(key)
+				break
+			}
+		}
+	}
+	u.RawQuery = query.Encode() // Encode sorts by key
+
+	return u.String()
+}
+
+// isMacro reports whether a query value is an unexpanded VAST/ad-server macro
+func isMacro(v string) bool {
+	v = strings.TrimSpace(v)
+	return (strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]")) ||
+		(strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}")) ||
+		(strings.HasPrefix(v, "%%") && strings.HasSuffix(v, "%%"))
+}
@@ -12,6 +12,7 @@ type Manifest struct {
 	PlaylistType    string
 	TargetDuration  float64
 	MediaSequence   int64
+	DiscontinuitySequence int64
 	Segments        []Segment
 	Discontinuity   bool
 	EndList         bool
@@ -52,6 +53,8 @@ func ParseManifest(content string) (*Manifest, error) {
 
 	var currentSegment *Segment
 	var currentKey *Key
+	// EXT-X-DISCONTINUITY usually precedes the segment's EXTINF
+	pendingDiscontinuity := false
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -68,10 +71,14 @@ func ParseManifest(content string) (*Manifest, error) {
 			fmt.Sscanf(line, "#EXT-X-TARGETDURATION:%f", &m.TargetDuration)
 		} else if strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:") {
 			fmt.Sscanf(line, "#EXT-X-MEDIA-SEQUENCE:%d", &m.MediaSequence)
+		} else if strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:") {
+			fmt.Sscanf(line, "#EXT-X-DISCONTINUITY-SEQUENCE:%d", &m.DiscontinuitySequence)
 		} else if strings.HasPrefix(line, "#EXT-X-DISCONTINUITY") {
 			m.Discontinuity = true
 			if currentSegment != nil {
 				currentSegment.Discontinuity = true
+			} else {
+				pendingDiscontinuity = true
 			}
 		} else if strings.HasPrefix(line, "#EXT-X-ENDLIST") {
 			m.EndList = true
@@ -113,11 +120,15 @@ func ParseManifest(content string) (*Manifest, error) {
 				programDateTime = currentSegment.ProgramDateTime
 			}
 			
+			discontinuity := pendingDiscontinuity || (currentSegment != nil && currentSegment.Discontinuity)
+			pendingDiscontinuity = false
+
 			currentSegment = &Segment{
 				Duration: duration,
 				Title:    title,
 				Key:      currentKey,
 				ProgramDateTime: programDateTime,
+				Discontinuity: discontinuity,
 			}
 		} else if !strings.HasPrefix(line, "#") && currentSegment != nil {
 			// This is a URI
@@ -161,14 +172,11 @@ func InsertAdSegments(m *Manifest, adSegments []AdSegment, insertIndex int) erro
 		if len(m.Segments) > 0 {
 			originStartTime := adStartTime.Add(totalAdDuration)
 			m.Segments[0].ProgramDateTime = &originStartTime
-			fmt.Printf("DEBUG: Ad ProgramDateTime: %v, Origin ProgramDateTime: %v (ad duration: %v)\n", 
-				adStartTime, originStartTime, totalAdDuration)
 		}
 		
 		// DO NOT adjust media sequence for LIVE streams
 		// LIVE streams must maintain their original sequence number
 		// Ads are inserted with DISCONTINUITY markers which allow sequence gaps
-		fmt.Printf("DEBUG: Maintaining original media sequence for LIVE stream: %d\n", m.MediaSequence)
 		
 		// Add ad segments first (pre-roll) with discontinuity marker
 		for i, adSeg := range adSegments {
@@ -186,7 +194,7 @@ func InsertAdSegments(m *Manifest, adSegments []AdSegment, insertIndex int) erro
 				URI:      adSeg.URI,
 				Duration: adSeg.Duration,
 				Title:    adSeg.Title,
-				Discontinuity: i == 0, // Only first ad segment has discontinuity
+				Discontinuity: i == 0 || adSeg.Discontinuity, // First ad segment and each new creative
 				ProgramDateTime: &segmentStartTime, // Synchronized ProgramDateTime
 			})
 		}
@@ -221,13 +229,13 @@ func InsertAdSegments(m *Manifest, adSegments []AdSegment, insertIndex int) erro
 	// Add segments before insertion point
 	newSegments = append(newSegments, m.Segments[:insertIndex+1]...)
 	
-	// Add ad segments with discontinuity on first ad only
+	// Add ad segments with discontinuity on first ad segment and each new creative
 	for i, adSeg := range adSegments {
 		newSegments = append(newSegments, Segment{
 			URI:           adSeg.URI,
 			Duration:      adSeg.Duration,
 			Title:         adSeg.Title,
-			Discontinuity: i == 0, // Only first ad segment has discontinuity
+			Discontinuity: i == 0 || adSeg.Discontinuity,
 		})
 	}
 	
@@ -244,12 +252,84 @@ func InsertAdSegments(m *Manifest, adSegments []AdSegment, insertIndex int) erro
 	return nil
 }
 
+// ReplaceSegments replaces the segments in [start, end) with ad segments.
+// Discontinuities mark the first ad segment, each new creative, and the first
+// content segment after the avail.
+func ReplaceSegments(m *Manifest, start, end int, adSegments []AdSegment) error {
+	if start < 0 || end > len(m.Segments) || start >= end {
+		return fmt.Errorf("invalid replace range [%d:%d] (manifest has %d segments)", start, end, len(m.Segments))
+	}
+
+	newSegments := make([]Segment, 0, len(m.Segments)-(end-start)+len(adSegments))
+	newSegments = append(newSegments, m.Segments[:start]...)
+
+	// Ad segments inherit the avail's program date time so the timeline matches the broadcast
+	var pdt *time.Time
+	if m.Segments[start].ProgramDateTime != nil {
+		t := *m.Segments[start].ProgramDateTime
+		pdt = &t
+	}
+
+	for i, adSeg := range adSegments {
+		seg := Segment{
+			URI:           adSeg.URI,
+			Duration:      adSeg.Duration,
+			Title:         adSeg.Title,
+			Discontinuity: i == 0 || adSeg.Discontinuity,
+		}
+		if pdt != nil {
+			segStart := *pdt
+			seg.ProgramDateTime = &segStart
+			next := pdt.Add(time.Duration(adSeg.Duration * float64(time.Second)))
+			pdt = &next
+		}
+		newSegments = append(newSegments, seg)
+	}
+
+	if end < len(m.Segments) {
+		remaining := m.Segments[end:]
+		if len(adSegments) > 0 {
+			remaining[0].Discontinuity = true
+		}
+		newSegments = append(newSegments, remaining...)
+	}
+
+	m.Segments = newSegments
+	return nil
+}
+
+// ClipAdSegments returns the ad segments that play between from and from+length seconds
+// into the pod, rounded to the nearest segment boundaries
+func ClipAdSegments(adSegments []AdSegment, from, length float64) []AdSegment {
+	clipped := []AdSegment{}
+
+	var position float64
+	for i, seg := range adSegments {
+		midpoint := position + seg.Duration/2
+		position += seg.Duration
+		if midpoint < from {
+			continue
+		}
+		if midpoint > from+length {
+			break
+		}
+		// The first segment played always needs a discontinuity
+		if len(clipped) == 0 && i > 0 {
+			seg.Discontinuity = true
+		}
+		clipped = append(clipped, seg)
+	}
+
+	return clipped
+}
+
 // AdSegment represents an ad segment to be inserted
 type AdSegment struct {
 	URI      string
 	Duration float64
 	Title    string
 	IsVAST   bool // True if URI is a VAST URL that needs processing
+	Discontinuity bool // True if this segment starts a new creative (or slate loop)
 }
 
 // RenderManifest converts manifest back to M3U8 string
@@ -277,6 +357,10 @@ func RenderManifest(m *Manifest) string {
 	if m.MediaSequence > 0 {
 		sb.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", m.MediaSequence))
 	}
+
+	if m.DiscontinuitySequence > 0 {
+		sb.WriteString(fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", m.DiscontinuitySequence))
+	}
 	
 	var currentKey *Key
 	for _, seg := range m.Segments {
@@ -0,0 +1,92 @@
+package hls
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Variant represents an EXT-X-STREAM-INF entry in a master playlist
+type Variant struct {
+	URI       string
+	Bandwidth int
+	Width     int
+	Height    int
+	Codecs    string
+	FrameRate float64
+}
+
+// ParseVariants extracts the variant streams from a master playlist
+func ParseVariants(content string) []Variant {
+	lines := strings.Split(content, "\n")
+	variants := []Variant{}
+
+	var current *Variant
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			v := &Variant{
+				Codecs: attrs["CODECS"],
+			}
+			v.Bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+			v.FrameRate, _ = strconv.ParseFloat(attrs["FRAME-RATE"], 64)
+			if res := attrs["RESOLUTION"]; res != "" {
+				if w, h, ok := strings.Cut(res, "x"); ok {
+					v.Width, _ = strconv.Atoi(w)
+					v.Height, _ = strconv.Atoi(h)
+				}
+			}
+			current = v
+		} else if !strings.HasPrefix(line, "#") && current != nil {
+			current.URI = line
+			variants = append(variants, *current)
+			current = nil
+		}
+	}
+
+	return variants
+}
+
+// parseAttributes parses an HLS attribute list (KEY=VALUE,KEY="VALUE",...)
+func parseAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+
+	for len(list) > 0 {
+		eq := strings.Index(list, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(list[:eq])
+		list = list[eq+1:]
+
+		var value string
+		if strings.HasPrefix(list, "\"") {
+			end := strings.Index(list[1:], "\"")
+			if end < 0 {
+				value = list[1:]
+				list = ""
+			} else {
+				value = list[1 : end+1]
+				list = list[end+2:]
+			}
+		} else {
+			end := strings.Index(list, ",")
+			if end < 0 {
+				value = list
+				list = ""
+			} else {
+				value = list[:end]
+				list = list[end:]
+			}
+		}
+		list = strings.TrimPrefix(list, ",")
+
+		attrs[key] = value
+	}
+
+	return attrs
+}
@@ -0,0 +1,30 @@
+package hls
+
+import (
+	"net/url"
+	"strings"
+)
+
+// AppendQuery adds query to every URI of a playlist: segment and variant lines as
+// well as URI attributes. Data URIs are left alone.
+func AppendQuery(content string, query url.Values) string {
+	if len(query) == 0 {
+		return content
+	}
+	encoded := query.Encode()
+
+	return RewriteURIs(content, func(uri string) string {
+		return appendQuery(uri, encoded)
+	})
+}
+
+func appendQuery(uri, encoded string) string {
+	fragment := ""
+	if i := strings.Index(uri, "#"); i >= 0 {
+		uri, fragment = uri[:i], uri[i:]
+	}
+	if strings.Contains(uri, "?") {
+		return uri + "&" + encoded + fragment
+	}
+	return uri + "?" + encoded + fragment
+}
@@ -0,0 +1,54 @@
+package hls
+
+// minSlateSegment is the shortest slate segment worth emitting; shorter gaps are left unfilled
+const minSlateSegment = 0.1
+
+// PadWithSlate pads an ad pod with looped slate segments up to target seconds.
+// The slate is looped as many times as needed (each loop starts with a discontinuity).
+// Only whole slate segments are used - players play a segment's full media whatever its
+// EXTINF says - so padding stops at the first segment that doesn't fit and the pod may
+// end up to one slate segment short of target.
+// Returns adSegments unchanged if the pod is already long enough or there is no slate.
+func PadWithSlate(adSegments []AdSegment, slate []Segment, target float64) []AdSegment {
+	var podDuration float64
+	for _, seg := range adSegments {
+		podDuration += seg.Duration
+	}
+
+	remaining := target - podDuration
+	if remaining < minSlateSegment || len(slate) == 0 {
+		return adSegments
+	}
+
+	var slateDuration float64
+	for _, seg := range slate {
+		slateDuration += seg.Duration
+	}
+	if slateDuration <= 0 {
+		return adSegments
+	}
+
+	padded := make([]AdSegment, 0, len(adSegments)+int(remaining/slateDuration+1)*len(slate))
+	padded = append(padded, adSegments...)
+
+	for i := 0; remaining >= minSlateSegment; i = (i + 1) % len(slate) {
+		seg := slate[i]
+		if seg.Duration <= 0 {
+			continue
+		}
+
+		if seg.Duration > remaining {
+			break
+		}
+
+		padded = append(padded, AdSegment{
+			URI:           seg.URI,
+			Duration:      seg.Duration,
+			Title:         "Slate",
+			Discontinuity: i == 0,
+		})
+		remaining -= seg.Duration
+	}
+
+	return padded
+}
@@ -0,0 +1,41 @@
+package hls
+
+import (
+	"regexp"
+	"strings"
+)
+
+// uriAttribute matches URI="..." attributes (EXT-X-KEY, EXT-X-MAP, EXT-X-MEDIA)
+var uriAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+
+// RewriteURIs replaces every URI of a playlist with rewrite(uri): segment and variant
+// lines as well as URI attributes. Empty and data URIs are left alone.
+func RewriteURIs(content string, rewrite func(uri string) string) string {
+	rewriteURI := func(uri string) string {
+		if uri == "" || strings.HasPrefix(uri, "data:") {
+			return uri
+		}
+		return rewrite(uri)
+	}
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "#") {
+			if strings.Contains(trimmed, `URI="`) {
+				lines[i] = uriAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+					return `URI="` + rewriteURI(attr[len(`URI="`):len(attr)-1]) + `"`
+				})
+			}
+			continue
+		}
+
+		lines[i] = rewriteURI(trimmed)
+	}
+
+	return strings.Join(lines, "\n")
+}
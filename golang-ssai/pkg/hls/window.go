@@ -0,0 +1,100 @@
+package hls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Window describes the segments of a live media playlist
+type Window struct {
+	MediaSequence         int64
+	DiscontinuitySequence int64
+	Segments              int
+	Discontinuities       int // EXT-X-DISCONTINUITY tags in the playlist
+	TargetDuration        float64
+	EndList               bool
+}
+
+// End returns the media sequence number following the last segment of the window
+func (w Window) End() int64 {
+	return w.MediaSequence + int64(w.Segments)
+}
+
+// ScanWindow reads the window of a media playlist without parsing its segments
+func ScanWindow(content string) Window {
+	var w Window
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			w.MediaSequence, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			w.DiscontinuitySequence, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"), 10, 64)
+		case line == "#EXT-X-DISCONTINUITY":
+			w.Discontinuities++
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			w.TargetDuration, _ = strconv.ParseFloat(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"), 64)
+		case line == "#EXT-X-ENDLIST":
+			w.EndList = true
+		case strings.HasPrefix(line, "#EXTINF:"):
+			w.Segments++
+		}
+	}
+	return w
+}
+
+// Resequence renumbers a media playlist, e.g. to continue another origin's numbering:
+// it sets EXT-X-MEDIA-SEQUENCE and EXT-X-DISCONTINUITY-SEQUENCE and, if breakIndex >= 0,
+// adds an EXT-X-DISCONTINUITY before the segment at that index
+func Resequence(content string, mediaSequence, discontinuitySequence int64, breakIndex int) string {
+	lines := strings.Split(content, "\n")
+	out := make([]string, 0, len(lines)+3)
+
+	header := fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d", mediaSequence)
+	discHeader := fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d", discontinuitySequence)
+	wroteHeaders := false
+	writeHeaders := func() {
+		if !wroteHeaders {
+			out = append(out, header, discHeader)
+			wroteHeaders = true
+		}
+	}
+
+	segment := 0
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#EXT-X-MEDIA-SEQUENCE:"),
+			strings.HasPrefix(trimmed, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			// Replaced by the headers written before the first segment
+			continue
+		case strings.HasPrefix(trimmed, "#EXTINF:"),
+			trimmed == "#EXT-X-DISCONTINUITY",
+			strings.HasPrefix(trimmed, "#EXT-X-PROGRAM-DATE-TIME:"),
+			strings.HasPrefix(trimmed, "#EXT-X-KEY:"),
+			strings.HasPrefix(trimmed, "#EXT-X-MAP:"),
+			strings.HasPrefix(trimmed, "#EXT-X-BYTERANGE:"),
+			strings.HasPrefix(trimmed, "#EXT-X-CUE"),
+			strings.HasPrefix(trimmed, "#EXT-X-DATERANGE:"),
+			strings.HasPrefix(trimmed, "#EXT-OATCLS-SCTE35:"):
+			// First tag of the first segment: the playlist header ends here
+			writeHeaders()
+		case trimmed == "#EXT-X-ENDLIST":
+			writeHeaders()
+		}
+
+		if strings.HasPrefix(trimmed, "#EXTINF:") {
+			if segment == breakIndex {
+				out = append(out, "#EXT-X-DISCONTINUITY")
+			}
+			segment++
+		}
+		out = append(out, line)
+	}
+
+	if !wroteHeaders {
+		out = append(out, header, discHeader)
+	}
+	return strings.Join(out, "\n")
+}
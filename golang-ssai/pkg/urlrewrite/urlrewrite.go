@@ -0,0 +1,92 @@
+package urlrewrite
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Pattern is a set of URL parts. As a match, empty parts match anything and Host may
+// start with "*." to match subdomains; as a replacement, empty parts are kept.
+type Pattern struct {
+	Scheme     string `yaml:"scheme"`      // http or https
+	Host       string `yaml:"host"`        // host[:port]
+	PathPrefix string `yaml:"path_prefix"` // e.g. "/ads/"
+}
+
+// Rule rewrites URLs matching Match with the parts set in Replace. A replaced
+// PathPrefix substitutes the matched prefix.
+type Rule struct {
+	Match   Pattern `yaml:"match"`
+	Replace Pattern `yaml:"replace"`
+}
+
+// Rules are tried in order; the first matching rule rewrites a URL
+type Rules []Rule
+
+// Apply returns rawURL rewritten by the first matching rule, or unchanged if no rule
+// matches or it can't be parsed. Rules with an empty match never match.
+func (r Rules) Apply(rawURL string) string {
+	if len(r) == 0 {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	for _, rule := range r {
+		if !rule.matches(u) {
+			continue
+		}
+
+		if rule.Replace.Scheme != "" {
+			u.Scheme = rule.Replace.Scheme
+		}
+		if rule.Replace.Host != "" {
+			u.Host = rule.Replace.Host
+		}
+		if rule.Replace.PathPrefix != "" {
+			u.Path = rule.Replace.PathPrefix + strings.TrimPrefix(u.Path, rule.Match.PathPrefix)
+			u.RawPath = ""
+		}
+		return u.String()
+	}
+	return rawURL
+}
+
+func (rule Rule) matches(u *url.URL) bool {
+	m := rule.Match
+	if m == (Pattern{}) {
+		return false
+	}
+	if m.Scheme != "" && !strings.EqualFold(m.Scheme, u.Scheme) {
+		return false
+	}
+	if m.Host != "" && !matchHost(m.Host, u.Host) {
+		return false
+	}
+	return strings.HasPrefix(u.Path, m.PathPrefix)
+}
+
+func matchHost(pattern, host string) bool {
+	pattern, host = strings.ToLower(pattern), strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(host, suffix)
+	}
+	return pattern == host
+}
+
+type ctxKey struct{}
+
+// WithRules returns a context carrying the rules of a request's tenant
+func WithRules(ctx context.Context, rules Rules) context.Context {
+	return context.WithValue(ctx, ctxKey{}, rules)
+}
+
+// FromContext returns the rules carried by ctx (none if it carries none)
+func FromContext(ctx context.Context) Rules {
+	rules, _ := ctx.Value(ctxKey{}).(Rules)
+	return rules
+}
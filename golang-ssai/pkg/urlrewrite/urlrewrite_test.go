@@ -0,0 +1,144 @@
+package urlrewrite
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRulesApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		in    string
+		want  string
+	}{
+		{
+			name:  "no rules",
+			rules: nil,
+			in:    "http://origin.example.com/live/index.m3u8",
+			want:  "http://origin.example.com/live/index.m3u8",
+		},
+		{
+			name:  "host match replaces host",
+			rules: Rules{{Match: Pattern{Host: "localhost:8080"}, Replace: Pattern{Host: "ads.example.com"}}},
+			in:    "http://localhost:8080/ads/1.m3u8",
+			want:  "http://ads.example.com/ads/1.m3u8",
+		},
+		{
+			name:  "host match is case-insensitive",
+			rules: Rules{{Match: Pattern{Host: "Origin.Example.com"}, Replace: Pattern{Host: "cdn.example.com"}}},
+			in:    "http://origin.example.COM/a.ts",
+			want:  "http://cdn.example.com/a.ts",
+		},
+		{
+			name:  "host mismatch",
+			rules: Rules{{Match: Pattern{Host: "origin.example.com"}, Replace: Pattern{Host: "cdn.example.com"}}},
+			in:    "http://other.example.com/a.ts",
+			want:  "http://other.example.com/a.ts",
+		},
+		{
+			name:  "scheme match",
+			rules: Rules{{Match: Pattern{Scheme: "http"}, Replace: Pattern{Scheme: "https"}}},
+			in:    "http://cdn.example.com/a.ts?x=1",
+			want:  "https://cdn.example.com/a.ts?x=1",
+		},
+		{
+			name:  "scheme mismatch",
+			rules: Rules{{Match: Pattern{Scheme: "http"}, Replace: Pattern{Scheme: "https"}}},
+			in:    "https://cdn.example.com/a.ts",
+			want:  "https://cdn.example.com/a.ts",
+		},
+		{
+			name:  "wildcard matches subdomains",
+			rules: Rules{{Match: Pattern{Host: "*.example.com"}, Replace: Pattern{Host: "cdn.example.net"}}},
+			in:    "http://edge1.origin.example.com/a.ts",
+			want:  "http://cdn.example.net/a.ts",
+		},
+		{
+			name:  "wildcard doesn't match the bare domain",
+			rules: Rules{{Match: Pattern{Host: "*.example.com"}, Replace: Pattern{Host: "cdn.example.net"}}},
+			in:    "http://example.com/a.ts",
+			want:  "http://example.com/a.ts",
+		},
+		{
+			name:  "wildcard doesn't match a lookalike domain",
+			rules: Rules{{Match: Pattern{Host: "*.example.com"}, Replace: Pattern{Host: "cdn.example.net"}}},
+			in:    "http://evilexample.com/a.ts",
+			want:  "http://evilexample.com/a.ts",
+		},
+		{
+			name:  "path prefix match",
+			rules: Rules{{Match: Pattern{PathPrefix: "/ads/"}, Replace: Pattern{Host: "ads.example.com"}}},
+			in:    "http://origin.example.com/ads/1.ts",
+			want:  "http://ads.example.com/ads/1.ts",
+		},
+		{
+			name:  "path prefix mismatch",
+			rules: Rules{{Match: Pattern{PathPrefix: "/ads/"}, Replace: Pattern{Host: "ads.example.com"}}},
+			in:    "http://origin.example.com/live/1.ts",
+			want:  "http://origin.example.com/live/1.ts",
+		},
+		{
+			name:  "replaced path prefix substitutes the matched one",
+			rules: Rules{{Match: Pattern{Host: "origin.example.com", PathPrefix: "/hls/"}, Replace: Pattern{PathPrefix: "/cdn/hls/"}}},
+			in:    "http://origin.example.com/hls/ch1/1.ts?t=2",
+			want:  "http://origin.example.com/cdn/hls/ch1/1.ts?t=2",
+		},
+		{
+			name:  "empty match never matches",
+			rules: Rules{{Replace: Pattern{Host: "cdn.example.com"}}},
+			in:    "http://origin.example.com/a.ts",
+			want:  "http://origin.example.com/a.ts",
+		},
+		{
+			name: "first matching rule wins",
+			rules: Rules{
+				{Match: Pattern{Host: "origin.example.com"}, Replace: Pattern{Host: "first.example.com"}},
+				{Match: Pattern{Host: "*.example.com"}, Replace: Pattern{Host: "second.example.com"}},
+			},
+			in:   "http://origin.example.com/a.ts",
+			want: "http://first.example.com/a.ts",
+		},
+		{
+			name: "later rule matches when earlier ones don't",
+			rules: Rules{
+				{Match: Pattern{Host: "other.example.com"}, Replace: Pattern{Host: "first.example.com"}},
+				{Match: Pattern{Host: "*.example.com"}, Replace: Pattern{Host: "second.example.com"}},
+			},
+			in:   "http://origin.example.com/a.ts",
+			want: "http://second.example.com/a.ts",
+		},
+		{
+			name:  "relative URL passes through",
+			rules: Rules{{Match: Pattern{PathPrefix: "/"}, Replace: Pattern{Host: "cdn.example.com"}}},
+			in:    "/segments/1.ts",
+			want:  "/segments/1.ts",
+		},
+		{
+			name:  "unparseable URL passes through",
+			rules: Rules{{Match: Pattern{Scheme: "http"}, Replace: Pattern{Host: "cdn.example.com"}}},
+			in:    "http://origin.example.com/%zz",
+			want:  "http://origin.example.com/%zz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.Apply(tt.in); got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if rules := FromContext(context.Background()); rules != nil {
+		t.Errorf("FromContext without rules = %v, want nil", rules)
+	}
+
+	rules := Rules{{Match: Pattern{Host: "a.example.com"}, Replace: Pattern{Host: "b.example.com"}}}
+	got := FromContext(WithRules(context.Background(), rules))
+	if len(got) != 1 || got[0] != rules[0] {
+		t.Errorf("FromContext = %v, want %v", got, rules)
+	}
+}